@@ -0,0 +1,268 @@
+// Package alarmstate keeps track of the state of Ring Alarm devices and
+// turns websocket updates or two snapshots into a list of changes.
+package alarmstate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+)
+
+// Device is the state of a Ring device the bridge reports changes for.
+type Device struct {
+	ZID           string `json:"zid"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Faulted       bool   `json:"faulted"`
+	Mode          string `json:"mode,omitempty"`
+	AlarmState    string `json:"alarmState,omitempty"`
+	BatteryLevel  int    `json:"batteryLevel,omitempty"`
+	BatteryStatus string `json:"batteryStatus,omitempty"`
+	TamperStatus  string `json:"tamperStatus,omitempty"`
+	CommStatus    string `json:"commStatus,omitempty"`
+	LastUpdate    int64  `json:"lastUpdate,omitempty"`
+}
+
+// Change is one field of a device that changed.
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Event is every change of one device at one point in time.
+type Event struct {
+	Time       time.Time `json:"time"`
+	ZID        string    `json:"zid"`
+	DeviceName string    `json:"name"`
+	DeviceType string    `json:"type"`
+	Changes    []Change  `json:"changes"`
+}
+
+// Snapshot is the state of every device, by zid.
+type Snapshot map[string]Device
+
+// NewSnapshot reads the state of every device in the device list.
+func NewSnapshot(info *httputil.RingDeviceInfo) Snapshot {
+	snapshot := Snapshot{}
+	if info == nil {
+		return snapshot
+	}
+	for i := range info.Body {
+		body := info.Body[i]
+		general := body.General.V2
+		snapshot[general.ZID] = Device{
+			ZID:           general.ZID,
+			Name:          general.Name,
+			Type:          general.DeviceType,
+			Faulted:       body.Device.V1.Faulted,
+			Mode:          body.Device.V1.Mode,
+			BatteryLevel:  general.BatteryLevel,
+			BatteryStatus: general.BatteryStatus,
+			TamperStatus:  general.TamperStatus,
+			CommStatus:    general.CommStatus,
+			LastUpdate:    general.LastUpdate,
+		}
+	}
+	if raw := rawBodies(info.Raw); raw != nil {
+		for _, partial := range raw {
+			if device, ok := snapshot[partial.General.V2.ZID]; ok && partial.Device.V1.AlarmInfo != nil {
+				device.AlarmState = partial.Device.V1.AlarmInfo.State
+				snapshot[device.ZID] = device
+			}
+		}
+	}
+	return snapshot
+}
+
+// Diff returns an event for every device whose state differs between the snapshots.
+// Devices that were added or removed are ignored.
+func Diff(previous, current Snapshot, at time.Time) []Event {
+	var events []Event
+	for _, zid := range current.zids() {
+		before, ok := previous[zid]
+		if !ok {
+			continue
+		}
+		after := current[zid]
+		if changes := compare(before, after); len(changes) > 0 {
+			events = append(events, Event{Time: at, ZID: zid, DeviceName: after.Name, DeviceType: after.Type, Changes: changes})
+		}
+	}
+	return events
+}
+
+// Version identifies the state of every device. It changes with any field
+// Diff reports, but not with the lastUpdate time Ring bumps on every check-in.
+func (s Snapshot) Version() string {
+	hash := sha256.New()
+	for _, zid := range s.zids() {
+		device := s[zid]
+		device.LastUpdate = 0
+		data, _ := json.Marshal(device)
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+func (s Snapshot) zids() []string {
+	zids := make([]string, 0, len(s))
+	for zid := range s {
+		zids = append(zids, zid)
+	}
+	sort.Strings(zids)
+	return zids
+}
+
+func compare(before, after Device) []Change {
+	var changes []Change
+	add := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, Change{Field: field, From: from, To: to})
+		}
+	}
+	add("faulted", strconv.FormatBool(before.Faulted), strconv.FormatBool(after.Faulted))
+	add("mode", before.Mode, after.Mode)
+	add("alarmState", before.AlarmState, after.AlarmState)
+	add("batteryLevel", strconv.Itoa(before.BatteryLevel), strconv.Itoa(after.BatteryLevel))
+	add("batteryStatus", before.BatteryStatus, after.BatteryStatus)
+	add("tamperStatus", before.TamperStatus, after.TamperStatus)
+	add("commStatus", before.CommStatus, after.CommStatus)
+	return changes
+}
+
+// partialBody is a device document in a DataUpdate. Ring only sends the fields
+// that changed, so every field is a pointer to tell a missing field from a zero value.
+type partialBody struct {
+	General struct {
+		V2 struct {
+			ZID           string  `json:"zid"`
+			Name          *string `json:"name"`
+			DeviceType    *string `json:"deviceType"`
+			BatteryLevel  *int    `json:"batteryLevel"`
+			BatteryStatus *string `json:"batteryStatus"`
+			TamperStatus  *string `json:"tamperStatus"`
+			CommStatus    *string `json:"commStatus"`
+			LastUpdate    *int64  `json:"lastUpdate"`
+		} `json:"v2"`
+	} `json:"general"`
+	Device struct {
+		V1 struct {
+			Faulted   *bool   `json:"faulted"`
+			Mode      *string `json:"mode"`
+			AlarmInfo *struct {
+				State string `json:"state"`
+			} `json:"alarmInfo"`
+		} `json:"v1"`
+	} `json:"device"`
+}
+
+func rawBodies(raw json.RawMessage) []partialBody {
+	if len(raw) == 0 {
+		return nil
+	}
+	var message struct {
+		Body []partialBody `json:"body"`
+	}
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return nil
+	}
+	return message.Body
+}
+
+// Tracker applies websocket updates to a snapshot. It is safe for concurrent use.
+type Tracker struct {
+	mu       sync.Mutex
+	snapshot Snapshot
+}
+
+// NewTracker starts tracking from the device list.
+func NewTracker(info *httputil.RingDeviceInfo) *Tracker {
+	return &Tracker{snapshot: NewSnapshot(info)}
+}
+
+// Snapshot returns a copy of the current state of every device.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snapshot := make(Snapshot, len(t.snapshot))
+	for zid, device := range t.snapshot {
+		snapshot[zid] = device
+	}
+	return snapshot
+}
+
+// Apply updates the state with a DataUpdate message and returns the changes.
+// Messages of any other kind are ignored.
+func (t *Tracker) Apply(update *httputil.RingDeviceInfo) []Event {
+	if update == nil || update.Message != "DataUpdate" {
+		return nil
+	}
+	at := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var events []Event
+	for _, partial := range rawBodies(update.Raw) {
+		zid := partial.General.V2.ZID
+		if zid == "" {
+			continue
+		}
+		before, known := t.snapshot[zid]
+		after := before
+		after.ZID = zid
+		apply(&after, partial)
+		t.snapshot[zid] = after
+		if !known {
+			continue
+		}
+		if changes := compare(before, after); len(changes) > 0 {
+			if after.LastUpdate > 0 {
+				at = time.Unix(0, after.LastUpdate*int64(time.Millisecond))
+			}
+			events = append(events, Event{Time: at, ZID: zid, DeviceName: after.Name, DeviceType: after.Type, Changes: changes})
+		}
+	}
+	return events
+}
+
+func apply(device *Device, partial partialBody) {
+	general := partial.General.V2
+	if general.Name != nil {
+		device.Name = *general.Name
+	}
+	if general.DeviceType != nil {
+		device.Type = *general.DeviceType
+	}
+	if general.BatteryLevel != nil {
+		device.BatteryLevel = *general.BatteryLevel
+	}
+	if general.BatteryStatus != nil {
+		device.BatteryStatus = *general.BatteryStatus
+	}
+	if general.TamperStatus != nil {
+		device.TamperStatus = *general.TamperStatus
+	}
+	if general.CommStatus != nil {
+		device.CommStatus = *general.CommStatus
+	}
+	if general.LastUpdate != nil {
+		device.LastUpdate = *general.LastUpdate
+	}
+	v1 := partial.Device.V1
+	if v1.Faulted != nil {
+		device.Faulted = *v1.Faulted
+	}
+	if v1.Mode != nil {
+		device.Mode = *v1.Mode
+	}
+	if v1.AlarmInfo != nil {
+		device.AlarmState = v1.AlarmInfo.State
+	}
+}
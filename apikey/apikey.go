@@ -0,0 +1,198 @@
+// Package apikey checks the scoped API keys of the bridge.
+//
+// A key is sent as "Authorization: Bearer rbk_<id>_<secret>". Only the SHA-256
+// of the secret is stored, in a secrets backend.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+// Scopes of a key.
+const (
+	ScopeStatusRead  = "status:read"
+	ScopeHistoryRead = "history:read"
+	ScopeArm         = "arm"
+	ScopeDisarm      = "disarm"
+	ScopeDevicesRead = "devices:read"
+	ScopeAuditRead   = "audit:read"
+	ScopeCodesRead   = "codes:read"
+	ScopeCodesWrite  = "codes:write"
+	// ScopeDevicesControl allows switch, dimmer and lock commands.
+	ScopeDevicesControl = "devices:control"
+)
+
+// AllScopes are the valid scopes.
+var AllScopes = []string{ScopeStatusRead, ScopeHistoryRead, ScopeArm, ScopeDisarm, ScopeDevicesRead, ScopeAuditRead, ScopeCodesRead, ScopeCodesWrite, ScopeDevicesControl}
+
+// prefix starts every key, so leaked keys are easy to search for.
+const prefix = "rbk_"
+
+// Errors of a request without a usable key.
+var (
+	ErrMissing = errors.New("no API key")
+	ErrInvalid = errors.New("invalid API key")
+	ErrRevoked = errors.New("API key is revoked")
+)
+
+// Key is a stored API key.
+type Key struct {
+	Name    string     `json:"name"`
+	ID      string     `json:"id"`
+	Hash    string     `json:"hash"`
+	Scopes  []string   `json:"scopes"`
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// Allows reports whether the key has the scope.
+func (k Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// KeySet is the layout of the API keys secret.
+type KeySet struct {
+	Keys []Key `json:"keys"`
+}
+
+// Find returns the key with the name.
+func (s KeySet) Find(name string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// ValidateScopes reports the first unknown scope.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("a key needs at least one scope")
+	}
+	for _, scope := range scopes {
+		valid := false
+		for _, known := range AllScopes {
+			valid = valid || scope == known
+		}
+		if !valid {
+			return fmt.Errorf("unknown scope %q, use %v", scope, strings.Join(AllScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// NewKey creates a key and returns it with the token the client sends.
+func NewKey(name string, scopes []string) (Key, string, error) {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return Key{}, "", fmt.Errorf("invalid key name %q", name)
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return Key{}, "", err
+	}
+	random := make([]byte, 40)
+	if _, err := rand.Read(random); err != nil {
+		return Key{}, "", err
+	}
+	id := hex.EncodeToString(random[:8])
+	secret := hex.EncodeToString(random[8:])
+	key := Key{Name: name, ID: id, Hash: hash(secret), Scopes: scopes, Created: time.Now().UTC()}
+	return key, prefix + id + "_" + secret, nil
+}
+
+// LoadKeys reads the key set from the backend. An empty secret holds no keys.
+func LoadKeys(backend secrets.Backend) (KeySet, error) {
+	var set KeySet
+	value, err := backend.Get()
+	if err != nil {
+		return set, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return set, nil
+	}
+	if err := json.Unmarshal([]byte(value), &set); err != nil {
+		return set, fmt.Errorf("invalid API keys in %v: %v", backend, err)
+	}
+	return set, nil
+}
+
+// SaveKeys writes the key set to the backend.
+func SaveKeys(backend secrets.Backend, set KeySet) error {
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.Put(string(data))
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Checker finds the key of a request in the keys of a backend.
+type Checker struct {
+	Backend secrets.Backend
+	// KeysTTL is how long the keys are used before they are read again.
+	KeysTTL time.Duration
+
+	keys secrets.Reloader
+}
+
+// Authenticate returns the key of the Authorization header value.
+func (c *Checker) Authenticate(authorization string) (Key, error) {
+	token := strings.TrimSpace(authorization)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	if token == "" {
+		return Key{}, ErrMissing
+	}
+	parts := strings.SplitN(strings.TrimPrefix(token, prefix), "_", 2)
+	if !strings.HasPrefix(token, prefix) || len(parts) != 2 {
+		return Key{}, ErrInvalid
+	}
+
+	keys, err := c.load()
+	if err != nil {
+		return Key{}, err
+	}
+	for _, key := range keys.Keys {
+		if key.ID != parts[0] {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash(parts[1]))) != 1 {
+			return Key{}, ErrInvalid
+		}
+		if key.Revoked != nil {
+			return key, ErrRevoked
+		}
+		return key, nil
+	}
+	return Key{}, ErrInvalid
+}
+
+// load returns the keys, reading them again once KeysTTL passed. The last keys
+// are kept when the backend fails.
+func (c *Checker) load() (KeySet, error) {
+	keys, err := c.keys.Get(c.KeysTTL, "API keys", func() (interface{}, error) { return LoadKeys(c.Backend) })
+	if err != nil {
+		return KeySet{}, err
+	}
+	return keys.(KeySet), nil
+}
@@ -0,0 +1,108 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{name: "granted scope", scopes: []string{ScopeStatusRead}, scope: ScopeStatusRead, want: true},
+		{name: "one of several", scopes: []string{ScopeStatusRead, ScopeArm, ScopeDisarm}, scope: ScopeDisarm, want: true},
+		{name: "other scope", scopes: []string{ScopeStatusRead}, scope: ScopeDisarm},
+		{name: "arm does not allow disarm", scopes: []string{ScopeArm}, scope: ScopeDisarm},
+		{name: "read does not allow write", scopes: []string{ScopeCodesRead}, scope: ScopeCodesWrite},
+		{name: "devices:read does not allow control", scopes: []string{ScopeDevicesRead}, scope: ScopeDevicesControl},
+		{name: "no prefix match", scopes: []string{"status"}, scope: ScopeStatusRead},
+		{name: "case sensitive", scopes: []string{"STATUS:READ"}, scope: ScopeStatusRead},
+		{name: "no scopes", scope: ScopeStatusRead},
+		{name: "empty scope", scopes: []string{ScopeStatusRead}, scope: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := Key{Name: "test", Scopes: test.scopes}
+			if got := key.Allows(test.scope); got != test.want {
+				t.Errorf("Allows(%q) with %v = %v, want %v", test.scope, test.scopes, got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		wantErr bool
+	}{
+		{name: "all scopes", scopes: AllScopes},
+		{name: "one scope", scopes: []string{ScopeDevicesControl}},
+		{name: "no scopes", wantErr: true},
+		{name: "unknown scope", scopes: []string{ScopeStatusRead, "admin"}, wantErr: true},
+		{name: "wildcard", scopes: []string{"*"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateScopes(test.scopes); (err != nil) != test.wantErr {
+				t.Errorf("ValidateScopes(%v) = %v, want error %v", test.scopes, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	active, activeToken, err := NewKey("dashboard", []string{ScopeStatusRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedToken, err := NewKey("old", []string{ScopeArm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt := time.Now()
+	revoked.Revoked = &revokedAt
+	backend := secrets.NewMemory("")
+	if err := SaveKeys(backend, KeySet{Keys: []Key{active, revoked}}); err != nil {
+		t.Fatal(err)
+	}
+	checker := &Checker{Backend: backend, KeysTTL: time.Minute}
+	_, unknownToken, err := NewKey("unknown", []string{ScopeStatusRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantKey       string
+		wantErr       error
+	}{
+		{name: "bearer token", authorization: "Bearer " + activeToken, wantKey: "dashboard"},
+		{name: "lower case bearer", authorization: "bearer " + activeToken, wantKey: "dashboard"},
+		{name: "token only", authorization: activeToken, wantKey: "dashboard"},
+		{name: "missing", authorization: "", wantErr: ErrMissing},
+		{name: "bearer without token", authorization: "Bearer ", wantErr: ErrInvalid},
+		{name: "without prefix", authorization: "Bearer " + strings.TrimPrefix(activeToken, prefix), wantErr: ErrInvalid},
+		{name: "wrong secret", authorization: "Bearer " + activeToken[:len(activeToken)-1] + "x", wantErr: ErrInvalid},
+		{name: "unknown id", authorization: "Bearer " + unknownToken, wantErr: ErrInvalid},
+		{name: "revoked", authorization: "Bearer " + revokedToken, wantKey: "old", wantErr: ErrRevoked},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := checker.Authenticate(test.authorization)
+			if err != test.wantErr {
+				t.Fatalf("Authenticate() = %v, want %v", err, test.wantErr)
+			}
+			if key.Name != test.wantKey {
+				t.Errorf("Authenticate() key = %q, want %q", key.Name, test.wantKey)
+			}
+		})
+	}
+}
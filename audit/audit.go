@@ -0,0 +1,132 @@
+// Package audit records the commands issued through the bridge in an
+// append-only log.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Results of an event.
+const (
+	ResultAllowed = "allowed"
+	ResultDenied  = "denied"
+	ResultLocked  = "locked"
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Caller is who issued the command.
+type Caller struct {
+	KeyID    string `json:"keyId,omitempty"`
+	KeyName  string `json:"keyName,omitempty"`
+	SourceIP string `json:"sourceIp,omitempty"`
+}
+
+// Event is one audited command.
+type Event struct {
+	Time time.Time `json:"time"`
+	Caller
+	Action     string `json:"action"`
+	LocationID string `json:"locationId,omitempty"`
+	Result     string `json:"result"`
+	LatencyMs  int64  `json:"latencyMs,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// Filter selects the events of a query.
+type Filter struct {
+	// From and To limit the event time, zero values are open ends.
+	From time.Time
+	To   time.Time
+	// Action only returns events of the action when set.
+	Action string
+	// Limit is the most events returned, newest first.
+	Limit int
+}
+
+// DefaultLimit is used by queries without a limit.
+const DefaultLimit = 50
+
+// matches reports whether the event passes the time and action filter.
+func (f Filter) matches(event Event) bool {
+	if !f.From.IsZero() && event.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !event.Time.Before(f.To) {
+		return false
+	}
+	return f.Action == "" || f.Action == event.Action
+}
+
+func (f Filter) limit() int {
+	if f.Limit > 0 {
+		return f.Limit
+	}
+	return DefaultLimit
+}
+
+// ErrNotQueryable is returned by sinks that can only be written.
+var ErrNotQueryable = errors.New("audit: the log sink can not be queried, read the AUDIT lines of the logs instead")
+
+// Sink stores events. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(event Event) error
+	// Query returns the matching events, newest first.
+	Query(filter Filter) ([]Event, error)
+}
+
+// New creates a Sink from a spec:
+//
+//	log               - one AUDIT line per event in the process log (default)
+//	file:<path>       - one JSON line per event appended to the file
+//	dynamodb:<table>  - one item per event in a DynamoDB table
+func New(spec string) (Sink, error) {
+	switch {
+	case spec == "" || spec == "log":
+		return LogSink{}, nil
+	case strings.HasPrefix(spec, "file:") && len(spec) > len("file:"):
+		return NewFileSink(strings.TrimPrefix(spec, "file:")), nil
+	case strings.HasPrefix(spec, "dynamodb:") && len(spec) > len("dynamodb:"):
+		return &DynamoDBSink{Table: strings.TrimPrefix(spec, "dynamodb:")}, nil
+	default:
+		return nil, fmt.Errorf("audit: unknown sink %q, use log, file:<path> or dynamodb:<table>", spec)
+	}
+}
+
+// Default is the sink Record writes to.
+var Default Sink = LogSink{}
+
+// Record writes the event to the Default sink. A failed write is logged with
+// the event, so it is not lost.
+func Record(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if err := Default.Write(event); err != nil {
+		log.Printf("Unable to write the audit event - %v", err)
+		LogSink{}.Write(event)
+	}
+}
+
+// LogSink writes the events to the log as JSON lines prefixed with AUDIT.
+type LogSink struct{}
+
+// Write logs the event.
+func (LogSink) Write(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	log.Printf("AUDIT %s", data)
+	return nil
+}
+
+// Query is not supported by the log.
+func (LogSink) Query(Filter) ([]Event, error) {
+	return nil, ErrNotQueryable
+}
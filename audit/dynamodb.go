@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// dynamoPartition is the partition key of every event. The bridge writes a
+// handful of events a day, one partition keeps them in time order.
+const dynamoPartition = "audit"
+
+// dynamoItem is an event as stored in DynamoDB, keyed by pk (string) and sk
+// (string, the RFC 3339 time with a random suffix).
+type dynamoItem struct {
+	PK string `dynamodbav:"pk"`
+	SK string `dynamodbav:"sk"`
+	Event
+}
+
+// DynamoDBSink stores the events in a DynamoDB table with the string keys pk and sk.
+type DynamoDBSink struct {
+	Table string
+	// Client is created from the environment when nil.
+	Client dynamodbiface.DynamoDBAPI
+}
+
+func (s *DynamoDBSink) client() (dynamodbiface.DynamoDBAPI, error) {
+	if s.Client == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		s.Client = dynamodb.New(sess)
+	}
+	return s.Client, nil
+}
+
+// Write puts the event, never overwriting an existing one.
+func (s *DynamoDBSink) Write(event Event) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	item, err := dynamodbattribute.MarshalMap(dynamoItem{PK: dynamoPartition, SK: sortKey(event.Time) + "#" + hex.EncodeToString(suffix), Event: event})
+	if err != nil {
+		return err
+	}
+	_, err = client.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(s.Table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(sk)"),
+	})
+	return err
+}
+
+// Query reads the events of the time range, newest first.
+func (s *DynamoDBSink) Query(filter Filter) ([]Event, error) {
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+	from, to := "0", "9"
+	if !filter.From.IsZero() {
+		from = sortKey(filter.From)
+	}
+	if !filter.To.IsZero() {
+		to = sortKey(filter.To)
+	}
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.Table),
+		KeyConditionExpression: aws.String("pk = :pk AND sk BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk":   {S: aws.String(dynamoPartition)},
+			":from": {S: aws.String(from)},
+			":to":   {S: aws.String(to)},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+	if filter.Action != "" {
+		input.FilterExpression = aws.String("#action = :action")
+		input.ExpressionAttributeNames = map[string]*string{"#action": aws.String("action")}
+		input.ExpressionAttributeValues[":action"] = &dynamodb.AttributeValue{S: aws.String(filter.Action)}
+	}
+
+	var events []Event
+	err = client.QueryPages(input, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range page.Items {
+			var stored dynamoItem
+			if err := dynamodbattribute.UnmarshalMap(item, &stored); err == nil && filter.matches(stored.Event) {
+				events = append(events, stored.Event)
+			}
+		}
+		return len(events) < filter.limit()
+	})
+	if len(events) > filter.limit() {
+		events = events[:filter.limit()]
+	}
+	return events, err
+}
+
+// sortKey formats the time so keys sort in time order.
+func sortKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
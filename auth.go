@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/apikey"
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/config"
+	"github.com/asishrs/smartthings-ringalarmv2/disarm"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/asishrs/smartthings-ringalarmv2/signature"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// tokens authenticates every request with the refresh token of RING_SECRET_BACKEND,
+// or the one serve found, nil when the requests carry their own access token.
+var tokens *bridge.TokenSource
+
+// configureSecrets reads the refresh token from RING_SECRET_BACKEND when it is set.
+func configureSecrets() error {
+	spec := os.Getenv("RING_SECRET_BACKEND")
+	if spec == "" {
+		return nil
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return err
+	}
+	log.Printf("Using the refresh token of %v", backend)
+	tokens = &bridge.TokenSource{
+		Load: func() (string, error) { return secrets.RefreshToken(backend) },
+		Save: func(refreshToken string) error {
+			err := secrets.SaveRefreshToken(backend, refreshToken)
+			audit.Record(audit.Event{Action: "token-rotate", Result: auditError(err), Detail: backend.String()})
+			return err
+		},
+	}
+	return nil
+}
+
+// authenticate replaces the credentials of the request with an access token for
+// the stored refresh token, and finds the location when the request has none.
+func authenticate(apiRequest *public.Request) error {
+	if tokens != nil {
+		if apiRequest.User != "" || apiRequest.Password != "" || apiRequest.RefreshToken != "" || apiRequest.AccessToken != "" {
+			log.Println("Ignoring the credentials in the request, the stored refresh token is used")
+		}
+		accessToken, err := tokens.AccessToken()
+		if err != nil {
+			return err
+		}
+		apiRequest.User, apiRequest.Password, apiRequest.RefreshToken = "", "", ""
+		apiRequest.AccessToken = accessToken
+	}
+	if apiRequest.LocationID == "" && apiRequest.AccessToken != "" {
+		location, err := bridge.Location(apiRequest.AccessToken)
+		if err != nil {
+			return err
+		}
+		apiRequest.LocationID = location.ID
+	}
+	return nil
+}
+
+// stateCache keeps the signature nonces and the failed disarm attempts.
+var stateCache = newStateCache()
+
+// requireSharedState is set for the Lambda, where any number of instances
+// answer requests and the disarm state must be in a cache.Shared store. serve
+// is one process, so its memory cache is seen by every request.
+var requireSharedState bool
+
+// sharedState reports whether stateCache is seen by every instance answering requests.
+func sharedState() bool {
+	if !requireSharedState {
+		return true
+	}
+	_, ok := stateCache.(cache.Shared)
+	return ok
+}
+
+func newStateCache() cache.Store {
+	store, err := cache.New(os.Getenv("RING_CACHE"))
+	if err != nil {
+		return cache.NewMemoryStore()
+	}
+	return store
+}
+
+// verifier checks the request signatures when RING_SIGNING_KEYS or
+// server.signingKeys is set.
+var verifier *signature.Verifier
+
+// configErr is set when the signing or API key configuration is invalid,
+// every request is refused rather than let through unchecked.
+var configErr error
+
+// configureSigning requires requests signed with the keys of spec when it is set.
+func configureSigning(spec string, window, keysTTL time.Duration) error {
+	if spec == "" {
+		return nil
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := signature.LoadKeys(backend); err != nil {
+		return err
+	}
+	if !sharedState() {
+		return errors.New("request signing needs RING_CACHE=dynamodb:<table>, so every Lambda instance sees the used nonces")
+	}
+	log.Printf("Requiring requests signed with the keys of %v", backend)
+	verifier = &signature.Verifier{Backend: backend, Window: window, KeysTTL: keysTTL, Nonces: stateCache}
+	return nil
+}
+
+// verifySignature answers 401 for a request without a valid signature. The
+// signed path is /<action>, the query and the signature.SignedHeaders are
+// signed as well.
+func verifySignature(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, bool) {
+	if configErr != nil {
+		response, _ := clientError(http.StatusInternalServerError)
+		return response, false
+	}
+	if verifier == nil {
+		return events.APIGatewayProxyResponse{}, true
+	}
+	key, err := verifier.Verify(signature.Request{
+		Method:  request.HTTPMethod,
+		Path:    "/" + request.PathParameters["ring-action"],
+		Query:   request.QueryStringParameters,
+		Headers: request.Headers,
+		Body:    []byte(request.Body),
+	})
+	switch err {
+	case nil:
+		log.Printf("Request signed with key %v", key)
+		return events.APIGatewayProxyResponse{}, true
+	case signature.ErrUnsigned, signature.ErrUnknownKey, signature.ErrRevoked, signature.ErrExpired, signature.ErrReplayed, signature.ErrBadSignature:
+		log.Printf("Rejected request signed with key %q - %v", key, err)
+		response, _ := clientError(http.StatusUnauthorized)
+		return response, false
+	default:
+		log.Printf("Unable to verify the request signature - %v", err)
+		response, _ := clientError(http.StatusInternalServerError)
+		return response, false
+	}
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", name, err)
+	}
+	return duration, nil
+}
+
+// configureAudit writes the audit events to the sink of the spec.
+func configureAudit(spec string) error {
+	sink, err := audit.New(spec)
+	if err != nil {
+		return err
+	}
+	audit.Default = sink
+	return nil
+}
+
+// auditError is the audit result of an operation.
+func auditError(err error) string {
+	if err != nil {
+		return audit.ResultFailure
+	}
+	return audit.ResultSuccess
+}
+
+// actionScopes is the API key scope each action needs. An action missing
+// here is refused to every key.
+var actionScopes = map[string]string{
+	"status":         apikey.ScopeStatusRead,
+	"status/wait":    apikey.ScopeStatusRead,
+	"events":         apikey.ScopeStatusRead,
+	"ws":             apikey.ScopeStatusRead,
+	"home":           apikey.ScopeArm,
+	"away":           apikey.ScopeArm,
+	"off":            apikey.ScopeDisarm,
+	"meta":           apikey.ScopeDevicesRead,
+	"devices":        apikey.ScopeDevicesRead,
+	"audit":          apikey.ScopeAuditRead,
+	"codes":          apikey.ScopeCodesRead,
+	"codes/add":      apikey.ScopeCodesWrite,
+	"codes/update":   apikey.ScopeCodesWrite,
+	"codes/remove":   apikey.ScopeCodesWrite,
+	"device/command": apikey.ScopeDevicesControl,
+}
+
+// apiKeys checks the bridge API keys when RING_API_KEYS is set.
+var apiKeys *apikey.Checker
+
+// configureAPIKeys requires an API key with the scope of the action when spec is set.
+func configureAPIKeys(spec string, keysTTL time.Duration) error {
+	if spec == "" {
+		return nil
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := apikey.LoadKeys(backend); err != nil {
+		return err
+	}
+	log.Printf("Requiring API keys of %v", backend)
+	apiKeys = &apikey.Checker{Backend: backend, KeysTTL: keysTTL}
+	return nil
+}
+
+// disarmGuard checks the disarm code when RING_DISARM_POLICY is set.
+var disarmGuard *disarm.Guard
+
+// configureDisarm requires a PIN or TOTP code to disarm when spec is set.
+func configureDisarm(spec string, policyTTL time.Duration) error {
+	if spec == "" {
+		return nil
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := disarm.LoadPolicy(backend); err != nil {
+		return err
+	}
+	if !sharedState() {
+		return errors.New("a disarm policy needs RING_CACHE=dynamodb:<table>, so every Lambda instance sees the wrong codes and the used TOTP codes")
+	}
+	log.Printf("Checking disarm codes against the policy of %v", backend)
+	disarmGuard = &disarm.Guard{Backend: backend, PolicyTTL: policyTTL, Attempts: stateCache}
+	return nil
+}
+
+// checkDisarm answers 403 for a disarm without the right code and 423 while
+// disarming is locked. Every try is audited.
+func checkDisarm(apiRequest public.Request, caller audit.Caller) (events.APIGatewayProxyResponse, bool) {
+	if disarmGuard == nil {
+		return events.APIGatewayProxyResponse{}, true
+	}
+	event := audit.Event{Caller: caller, Action: "disarm-code", LocationID: apiRequest.LocationID}
+	err := disarmGuard.Check(apiRequest.LocationID, apiRequest.DisarmCode)
+	var locked *disarm.ErrLocked
+	var status int
+	switch {
+	case err == nil:
+		event.Result = audit.ResultAllowed
+		audit.Record(event)
+		return events.APIGatewayProxyResponse{}, true
+	case errors.As(err, &locked):
+		event.Result, status = audit.ResultLocked, http.StatusLocked
+	case err == disarm.ErrCodeRequired, err == disarm.ErrWrongCode:
+		event.Result, status = audit.ResultDenied, http.StatusForbidden
+	default:
+		event.Result, status = audit.ResultFailure, http.StatusInternalServerError
+	}
+	event.Detail = err.Error()
+	audit.Record(event)
+	response, _ := clientError(status)
+	return response, false
+}
+
+// configureServer applies the request checks of the profile to serve. serve
+// authenticates the requests with source when it has a refresh token.
+func configureServer(profile config.Profile, source *bridge.TokenSource) error {
+	tokens = source
+	if err := configureSigning(profile.Server.SigningKeys, profile.Server.SignatureWindow, time.Minute); err != nil {
+		return fmt.Errorf("server.signingKeys: %v", err)
+	}
+	if err := configureAPIKeys(profile.Server.APIKeys, time.Minute); err != nil {
+		return fmt.Errorf("server.apiKeys: %v", err)
+	}
+	if err := configureDisarm(profile.Server.DisarmPolicy, time.Minute); err != nil {
+		return fmt.Errorf("server.disarmPolicy: %v", err)
+	}
+	return nil
+}
+
+// authorizeStream checks the signature and API key of an events client of serve.
+func authorizeStream(request events.APIGatewayProxyRequest, action string) (events.APIGatewayProxyResponse, bool) {
+	if response, ok := verifySignature(request); !ok {
+		return response, false
+	}
+	_, response, ok := authorize(request, action)
+	return response, ok
+}
+
+// authorize answers 401 for a request without a valid API key and 403 when
+// the key does not have the scope of the action or no scope allows it.
+func authorize(request events.APIGatewayProxyRequest, action string) (apikey.Key, events.APIGatewayProxyResponse, bool) {
+	if apiKeys == nil {
+		return apikey.Key{}, events.APIGatewayProxyResponse{}, true
+	}
+	key, err := apiKeys.Authenticate(header(request.Headers, "Authorization"))
+	switch err {
+	case nil:
+	case apikey.ErrMissing, apikey.ErrInvalid, apikey.ErrRevoked:
+		log.Printf("Rejected API key %q - %v", key.Name, err)
+		response, _ := clientError(http.StatusUnauthorized)
+		return key, response, false
+	default:
+		log.Printf("Unable to check the API key - %v", err)
+		response, _ := clientError(http.StatusInternalServerError)
+		return key, response, false
+	}
+
+	scope, ok := actionScopes[action]
+	if !ok {
+		log.Printf("API key %v used for %v, which no scope allows", key.Name, action)
+		response, _ := clientError(http.StatusForbidden)
+		return key, response, false
+	}
+	if !key.Allows(scope) {
+		log.Printf("API key %v does not have the %v scope", key.Name, scope)
+		response, _ := clientError(http.StatusForbidden)
+		return key, response, false
+	}
+	log.Printf("Request with API key %v", key.Name)
+	return key, events.APIGatewayProxyResponse{}, true
+}
+
+// header returns the header, API Gateway passes the names as the client sent them.
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
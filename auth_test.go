@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/apikey"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAuthorize(t *testing.T) {
+	readOnly, readOnlyToken, err := apikey.NewKey("dashboard", []string{apikey.ScopeStatusRead, apikey.ScopeDevicesRead, apikey.ScopeCodesRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, controlToken, err := apikey.NewKey("automation", []string{apikey.ScopeDevicesControl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := secrets.NewMemory("")
+	if err := apikey.SaveKeys(backend, apikey.KeySet{Keys: []apikey.Key{readOnly, control}}); err != nil {
+		t.Fatal(err)
+	}
+	apiKeys = &apikey.Checker{Backend: backend, KeysTTL: time.Minute}
+	defer func() { apiKeys = nil }()
+
+	tests := []struct {
+		name       string
+		token      string
+		action     string
+		wantStatus int
+	}{
+		{name: "read-only key reads the status", token: readOnlyToken, action: "status"},
+		{name: "read-only key opens the event stream", token: readOnlyToken, action: "events"},
+		{name: "read-only key reads the codes", token: readOnlyToken, action: "codes"},
+		{name: "read-only key sends a device command", token: readOnlyToken, action: "device/command", wantStatus: http.StatusForbidden},
+		{name: "read-only key arms", token: readOnlyToken, action: "away", wantStatus: http.StatusForbidden},
+		{name: "read-only key disarms", token: readOnlyToken, action: "off", wantStatus: http.StatusForbidden},
+		{name: "read-only key adds a code", token: readOnlyToken, action: "codes/add", wantStatus: http.StatusForbidden},
+		{name: "read-only key removes a code", token: readOnlyToken, action: "codes/remove", wantStatus: http.StatusForbidden},
+		{name: "control key sends a device command", token: controlToken, action: "device/command"},
+		{name: "control key disarms", token: controlToken, action: "off", wantStatus: http.StatusForbidden},
+		{name: "unmapped action", token: controlToken, action: "device/unknown", wantStatus: http.StatusForbidden},
+		{name: "no key", action: "status", wantStatus: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{Headers: map[string]string{}}
+			if test.token != "" {
+				request.Headers["Authorization"] = "Bearer " + test.token
+			}
+			_, response, ok := authorize(request, test.action)
+			if ok != (test.wantStatus == 0) || response.StatusCode != test.wantStatus {
+				t.Errorf("authorize(%q) = %v, %v, want %v", test.action, response.StatusCode, ok, test.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+)
+
+// Keypad codes are access-code devices managed through the access-code.vault
+// device of the location, with these DeviceInfoSet commands.
+const (
+	vaultType         = "access-code.vault"
+	codeType          = "access-code"
+	commandAddCode    = "vault.add-code"
+	commandUpdateCode = "vault.update-code"
+	commandRemoveCode = "vault.remove-code"
+)
+
+// codePattern is what the keypad accepts.
+var codePattern = regexp.MustCompile(`^[0-9]{4,8}$`)
+
+// ErrNoVault is returned for a location without the access code vault.
+var ErrNoVault = errors.New("no " + vaultType + " device, the location has no keypad codes")
+
+// errNoRaw is returned for a device list that was not read from Ring directly.
+var errNoRaw = errors.New("device list without the Ring message")
+
+// InvalidCodeError is an access code Ring would not accept.
+type InvalidCodeError struct {
+	Reason string
+}
+
+func (e *InvalidCodeError) Error() string { return "invalid access code: " + e.Reason }
+
+// codeBody is the part of an access-code or vault device the bridge reads.
+type codeBody struct {
+	General struct {
+		V2 struct {
+			ZID        string `json:"zid"`
+			Name       string `json:"name"`
+			DeviceType string `json:"deviceType"`
+		} `json:"v2"`
+	} `json:"general"`
+	Device struct {
+		V1 struct {
+			Schedule *codeSchedule `json:"schedule"`
+		} `json:"v1"`
+	} `json:"device"`
+}
+
+// codeSchedule limits a temporary code to a time range in milliseconds.
+type codeSchedule struct {
+	Start int64 `json:"startTime"`
+	End   int64 `json:"endTime"`
+}
+
+// codeData is the data of the vault commands.
+type codeData struct {
+	ZID      string        `json:"zid,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Code     string        `json:"code,omitempty"`
+	Schedule *codeSchedule `json:"schedule,omitempty"`
+}
+
+// codeDevices reads the vault and the access-code devices of a device list.
+// The typed list drops the schedule, so the message Ring sent is read again.
+func codeDevices(devices *httputil.RingDeviceInfo) (string, []codeBody, error) {
+	var message struct {
+		Body []codeBody `json:"body"`
+	}
+	if len(devices.Raw) == 0 {
+		return "", nil, errNoRaw
+	}
+	if err := json.Unmarshal(devices.Raw, &message); err != nil {
+		return "", nil, err
+	}
+	var vault string
+	var codes []codeBody
+	for _, body := range message.Body {
+		switch body.General.V2.DeviceType {
+		case vaultType:
+			vault = body.General.V2.ZID
+		case codeType:
+			codes = append(codes, body)
+		}
+	}
+	if vault == "" {
+		return "", nil, ErrNoVault
+	}
+	return vault, codes, nil
+}
+
+func publicCode(body codeBody) public.AccessCode {
+	code := public.AccessCode{ID: body.General.V2.ZID, Name: body.General.V2.Name}
+	if schedule := body.Device.V1.Schedule; schedule != nil {
+		code.Start = fromMillis(schedule.Start)
+		code.End = fromMillis(schedule.End)
+	}
+	return code
+}
+
+func fromMillis(ms int64) string {
+	if ms == 0 {
+		return ""
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+// schedule parses the start and end of a code, nil for a permanent one.
+func schedule(code public.AccessCode, now time.Time) (*codeSchedule, error) {
+	if code.Start == "" && code.End == "" {
+		return nil, nil
+	}
+	if code.Start == "" || code.End == "" {
+		return nil, &InvalidCodeError{"a temporary code needs both start and end"}
+	}
+	start, err := time.Parse(time.RFC3339, code.Start)
+	if err != nil {
+		return nil, &InvalidCodeError{"start must be an RFC 3339 time"}
+	}
+	end, err := time.Parse(time.RFC3339, code.End)
+	if err != nil {
+		return nil, &InvalidCodeError{"end must be an RFC 3339 time"}
+	}
+	if !end.After(start) {
+		return nil, &InvalidCodeError{"end must be after start"}
+	}
+	if !end.After(now) {
+		return nil, &InvalidCodeError{"end is in the past"}
+	}
+	return &codeSchedule{Start: start.UnixNano() / int64(time.Millisecond), End: end.UnixNano() / int64(time.Millisecond)}, nil
+}
+
+// findCode returns the code with the id, or else the name.
+func findCode(codes []codeBody, idOrName string) (codeBody, bool) {
+	for _, code := range codes {
+		if code.General.V2.ZID == idOrName {
+			return code, true
+		}
+	}
+	for _, code := range codes {
+		if strings.EqualFold(code.General.V2.Name, idOrName) {
+			return code, true
+		}
+	}
+	return codeBody{}, false
+}
+
+// codeSession reads the vault and codes over a fresh device list.
+func codeSession(locationID, accessToken string) (*Session, string, []codeBody, error) {
+	ring := NewSession(locationID, accessToken)
+	session, err := ring.Open()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	devices, err := session.DeviceList()
+	if err != nil {
+		ring.Close()
+		return nil, "", nil, err
+	}
+	vault, codes, err := codeDevices(devices)
+	if err != nil {
+		ring.Close()
+		return nil, "", nil, err
+	}
+	return ring, vault, codes, nil
+}
+
+// AccessCodes lists the keypad codes of the location.
+func AccessCodes(locationID, accessToken string) ([]public.AccessCode, error) {
+	ring, _, codes, err := codeSession(locationID, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	ring.Close()
+	list := []public.AccessCode{}
+	for _, code := range codes {
+		list = append(list, publicCode(code))
+	}
+	return list, nil
+}
+
+// AddAccessCode creates a keypad code for the user name and returns it as
+// listed afterwards. Names are unique, so the new code can be told apart.
+func AddAccessCode(locationID, accessToken string, code public.AccessCode) (public.AccessCode, error) {
+	if strings.TrimSpace(code.Name) == "" {
+		return public.AccessCode{}, &InvalidCodeError{"a name is required"}
+	}
+	if !codePattern.MatchString(code.Code) {
+		return public.AccessCode{}, &InvalidCodeError{"the code must be 4 to 8 digits"}
+	}
+	schedule, err := schedule(code, time.Now())
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+
+	unlock, err := lockLocation(locationID)
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	defer unlock()
+	ring, vault, codes, err := codeSession(locationID, accessToken)
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	defer ring.Close()
+	if _, found := findCode(codes, code.Name); found {
+		return public.AccessCode{}, &InvalidCodeError{fmt.Sprintf("%v already has a code", code.Name)}
+	}
+	session, _ := ring.Open()
+	if err := session.Command(vault, commandAddCode, codeData{Name: code.Name, Code: code.Code, Schedule: schedule}); err != nil {
+		return public.AccessCode{}, err
+	}
+
+	devices, err := session.DeviceList()
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	if _, codes, err = codeDevices(devices); err != nil {
+		return public.AccessCode{}, err
+	}
+	added, found := findCode(codes, code.Name)
+	if !found {
+		return public.AccessCode{}, fmt.Errorf("ring did not add the code of %v", code.Name)
+	}
+	return publicCode(added), nil
+}
+
+// UpdateAccessCode changes the name, code or schedule of the code with the id
+// or name. Empty fields are kept. A permanent code can be made temporary, a
+// temporary code stays temporary until it is removed.
+func UpdateAccessCode(locationID, accessToken, idOrName string, code public.AccessCode) (public.AccessCode, error) {
+	if code.Code != "" && !codePattern.MatchString(code.Code) {
+		return public.AccessCode{}, &InvalidCodeError{"the code must be 4 to 8 digits"}
+	}
+	schedule, err := schedule(code, time.Now())
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	if code.Name == "" && code.Code == "" && schedule == nil {
+		return public.AccessCode{}, &InvalidCodeError{"nothing to update, set a name, code or start and end"}
+	}
+
+	unlock, err := lockLocation(locationID)
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	defer unlock()
+	ring, vault, codes, err := codeSession(locationID, accessToken)
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	defer ring.Close()
+	current, found := findCode(codes, idOrName)
+	if !found {
+		return public.AccessCode{}, &InvalidCodeError{fmt.Sprintf("no code %v", idOrName)}
+	}
+	if other, taken := findCode(codes, code.Name); code.Name != "" && taken && other.General.V2.ZID != current.General.V2.ZID {
+		return public.AccessCode{}, &InvalidCodeError{fmt.Sprintf("%v already has a code", code.Name)}
+	}
+	session, _ := ring.Open()
+	zid := current.General.V2.ZID
+	if err := session.Command(vault, commandUpdateCode, codeData{ZID: zid, Name: code.Name, Code: code.Code, Schedule: schedule}); err != nil {
+		return public.AccessCode{}, err
+	}
+
+	updated := publicCode(current)
+	if code.Name != "" {
+		updated.Name = code.Name
+	}
+	if schedule != nil {
+		updated.Start, updated.End = fromMillis(schedule.Start), fromMillis(schedule.End)
+	}
+	return updated, nil
+}
+
+// RemoveAccessCode deletes the code with the id or name and returns it.
+func RemoveAccessCode(locationID, accessToken, idOrName string) (public.AccessCode, error) {
+	unlock, err := lockLocation(locationID)
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	defer unlock()
+	ring, vault, codes, err := codeSession(locationID, accessToken)
+	if err != nil {
+		return public.AccessCode{}, err
+	}
+	defer ring.Close()
+	current, found := findCode(codes, idOrName)
+	if !found {
+		return public.AccessCode{}, &InvalidCodeError{fmt.Sprintf("no code %v", idOrName)}
+	}
+	session, _ := ring.Open()
+	if err := session.Command(vault, commandRemoveCode, codeData{ZID: current.General.V2.ZID}); err != nil {
+		return public.AccessCode{}, err
+	}
+	return publicCode(current), nil
+}
@@ -0,0 +1,244 @@
+// Package bridge holds the Ring operations shared by the Lambda handler and
+// the command line utility.
+package bridge
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/retry"
+)
+
+// ErrAccessDenied is returned when Ring refuses the refresh token.
+var ErrAccessDenied = errors.New("access_denied")
+
+// Modes maps the bridge actions to the Ring security panel modes.
+var Modes = map[string]string{
+	"home": "some",
+	"away": "all",
+	"off":  "none",
+}
+
+// ModeName returns a readable name for a Ring security panel mode.
+func ModeName(mode string) string {
+	switch mode {
+	case "none":
+		return "Disarmed"
+	case "some":
+		return "Home"
+	case "all":
+		return "Away"
+	default:
+		return mode
+	}
+}
+
+// ringCache keeps the location, ZID and device list of an account between
+// invocations. The default in memory store survives warm Lambda invocations.
+var ringCache = newCache()
+
+var (
+	locationTTL = durationFromEnv("RING_CACHE_LOCATION_TTL", 24*time.Hour)
+	zidTTL      = durationFromEnv("RING_CACHE_ZID_TTL", 24*time.Hour)
+	devicesTTL  = durationFromEnv("RING_CACHE_DEVICES_TTL", 30*time.Second)
+)
+
+// ringRetry retries the idempotent Ring calls. Its breaker is shared by every
+// call, so once Ring is down requests fail fast until the cooldown passes.
+var ringRetry = retry.Policy{
+	Attempts:  intFromEnv("RING_RETRY_ATTEMPTS", 3),
+	BaseDelay: durationFromEnv("RING_RETRY_BASE_DELAY", 200*time.Millisecond),
+	MaxDelay:  durationFromEnv("RING_RETRY_MAX_DELAY", 2*time.Second),
+	Breaker: &retry.Breaker{
+		Threshold: intFromEnv("RING_BREAKER_THRESHOLD", 5),
+		Cooldown:  durationFromEnv("RING_BREAKER_COOLDOWN", 30*time.Second),
+	},
+}
+
+func newCache() cache.Store {
+	store, err := cache.New(os.Getenv("RING_CACHE"))
+	if err != nil {
+		log.Printf("%v, using in memory cache", err)
+		return cache.NewMemoryStore()
+	}
+	return store
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %v %q, using %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+func intFromEnv(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %v %q, using %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return number
+}
+
+// tokenKey identifies an access token in cache keys without storing the token.
+func tokenKey(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return hex.EncodeToString(sum[:8])
+}
+
+func devicesCacheKey(locationID, accessToken string) string {
+	return "devices:" + locationID + ":" + tokenKey(accessToken)
+}
+
+// AccessToken exchanges the refresh token for an access token. Ring may hand
+// out a new refresh token, which is returned as well.
+func AccessToken(refreshToken string) (string, string, error) {
+	httputil.Trace.Println("Using Refresh Token to Authenticate Ring API")
+	oauthResponse, err := httputil.AuthRequestWithRefreshToken("https://oauth.ring.com/oauth/token", httputil.OAuthRequestWithRefreshToken{ClientID: "ring_official_ios", GrantType: "refresh_token", RefreshToken: refreshToken})
+	if err != nil {
+		return "", refreshToken, err
+	}
+	if oauthResponse.Error == "access_denied" {
+		return oauthResponse.AccessToken, oauthResponse.RefreshToken, ErrAccessDenied
+	}
+	if oauthResponse.Error != "" {
+		return "", refreshToken, errors.New("Ring API Error - " + oauthResponse.Error)
+	}
+	return oauthResponse.AccessToken, oauthResponse.RefreshToken, nil
+}
+
+// PasswordAccessToken authenticates with the user name and password of an account without 2FA.
+func PasswordAccessToken(user, password string) (string, error) {
+	httputil.Trace.Println("Using User Name & Password to Authenticate Ring API")
+	oauthResponse, err := httputil.AuthRequest("https://oauth.ring.com/oauth/token", httputil.OAuthRequest{ClientID: "ring_official_ios", GrantType: "password", Password: password, Scope: "client", Username: user}, "")
+	return oauthResponse.AccessToken, err
+}
+
+// Location returns the location of the account.
+func Location(accessToken string) (httputil.UserLocation, error) {
+	key := "location:" + tokenKey(accessToken)
+	var location httputil.UserLocation
+	if cache.GetJSON(ringCache, key, &location) {
+		return location, nil
+	}
+
+	err := ringRetry.Do("Location request", func() error {
+		var err error
+		location, err = httputil.LocationRequest("https://api.ring.com/devices/v1/locations", accessToken)
+		return err
+	})
+	if err != nil {
+		return httputil.UserLocation{}, err
+	}
+	cache.SetJSON(ringCache, key, location, locationTTL)
+
+	return location, nil
+}
+
+// Devices returns the device list of the location on its own websocket connection.
+func Devices(locationID string, accessToken string) (*httputil.RingDeviceInfo, error) {
+	ring := NewSession(locationID, accessToken)
+	defer ring.Close()
+	return ring.Devices()
+}
+
+// ErrLocationBusy is returned when another bridge instance changed the
+// location for longer than RING_LOCK_WAIT.
+var ErrLocationBusy = errors.New("another change of the location is running, try again")
+
+var (
+	lockTTL  = durationFromEnv("RING_LOCK_TTL", time.Minute)
+	lockWait = durationFromEnv("RING_LOCK_WAIT", 20*time.Second)
+	lockPoll = 250 * time.Millisecond
+)
+
+// locationLocks holds a mutex per location, see lockLocation.
+var locationLocks sync.Map
+
+// lockLocation serializes the mode, access code and device changes of a
+// location and returns the unlock function. Within the process a mutex is
+// enough. When ringCache is a cache.Shared store the location is also locked
+// there, so Lambda instances wait for each other. The lock expires after
+// RING_LOCK_TTL in case its holder dies.
+func lockLocation(locationID string) (func(), error) {
+	lock, _ := locationLocks.LoadOrStore(locationID, &sync.Mutex{})
+	mutex := lock.(*sync.Mutex)
+	mutex.Lock()
+	shared, ok := ringCache.(cache.Shared)
+	if !ok {
+		return mutex.Unlock, nil
+	}
+
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	key := "lock:" + locationID
+	deadline := time.Now().Add(lockWait)
+	for {
+		claimed, err := shared.Add(key, owner, lockTTL)
+		if err != nil {
+			mutex.Unlock()
+			return nil, err
+		}
+		if claimed {
+			break
+		}
+		if time.Now().After(deadline) {
+			mutex.Unlock()
+			return nil, ErrLocationBusy
+		}
+		time.Sleep(lockPoll)
+	}
+	return func() {
+		if err := shared.DeleteValue(key, owner); err != nil {
+			log.Printf("Unable to unlock location %v, it unlocks after %v - %v", locationID, lockTTL, err)
+		}
+		mutex.Unlock()
+	}, nil
+}
+
+// SetMode switches the security panel of the location to the mode and reports
+// whether it was changed, false when the panel already was in the mode. An
+// empty zid is looked up from the device list. Mode changes of one location
+// run one after the other.
+func SetMode(locationID, accessToken, zID, mode string) (bool, error) {
+	unlock, err := lockLocation(locationID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	ring := NewSession(locationID, accessToken)
+	defer ring.Close()
+
+	zID, err = ring.ZID(zID)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := ring.SetMode(zID, mode)
+	// The panel mode in the device snapshot is stale now.
+	ringCache.Delete(devicesCacheKey(locationID, accessToken))
+	return changed, err
+}
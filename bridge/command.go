@@ -0,0 +1,164 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// deviceCommand is a command the bridge sends to a Z-Wave device of the base station.
+type deviceCommand struct {
+	// types are the device types that take the command.
+	types []string
+	// commandType is the Ring command, which the device must list in its
+	// commandTypes. Commands without one set a device field instead.
+	commandType string
+	// needsLevel is set for commands that take a level from 0 to 100.
+	needsLevel bool
+}
+
+// Command names of the device commands.
+const (
+	CommandSwitchOn    = "switch.on"
+	CommandSwitchOff   = "switch.off"
+	CommandDimmerLevel = "dimmer.level"
+	CommandLockLock    = "lock.lock"
+	CommandLockUnlock  = "lock.unlock"
+)
+
+var deviceCommands = map[string]deviceCommand{
+	CommandSwitchOn:    {types: []string{"switch", "switch.multilevel"}},
+	CommandSwitchOff:   {types: []string{"switch", "switch.multilevel"}},
+	CommandDimmerLevel: {types: []string{"switch.multilevel"}, needsLevel: true},
+	CommandLockLock:    {types: []string{"lock"}, commandType: "lock.lock"},
+	CommandLockUnlock:  {types: []string{"lock"}, commandType: "lock.unlock"},
+}
+
+// DeviceCommands returns the names of the device commands.
+func DeviceCommands() []string {
+	var names []string
+	for name := range deviceCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InvalidCommandError is a command the device does not take.
+type InvalidCommandError struct {
+	Reason string
+}
+
+func (e *InvalidCommandError) Error() string { return "invalid device command: " + e.Reason }
+
+// commandBody is the part of a device the bridge checks before a command.
+type commandBody struct {
+	General struct {
+		V2 struct {
+			ZID          string                     `json:"zid"`
+			Name         string                     `json:"name"`
+			DeviceType   string                     `json:"deviceType"`
+			CommandTypes map[string]json.RawMessage `json:"commandTypes"`
+		} `json:"v2"`
+	} `json:"general"`
+}
+
+// DeviceCommandResult is the device a command was sent to.
+type DeviceCommandResult struct {
+	ZID  string
+	Name string
+	Type string
+}
+
+// SendDeviceCommand sends the command to the device with the zid or name,
+// after checking the device type and commandTypes take it. level is only
+// used by dimmer.level, from 0 to 100.
+func SendDeviceCommand(locationID, accessToken, zidOrName, command string, level *int) (DeviceCommandResult, error) {
+	known, ok := deviceCommands[command]
+	if !ok {
+		return DeviceCommandResult{}, &InvalidCommandError{fmt.Sprintf("unknown command %q, use %v", command, strings.Join(DeviceCommands(), ", "))}
+	}
+	if known.needsLevel && (level == nil || *level < 0 || *level > 100) {
+		return DeviceCommandResult{}, &InvalidCommandError{command + " needs a level from 0 to 100"}
+	}
+
+	unlock, err := lockLocation(locationID)
+	if err != nil {
+		return DeviceCommandResult{}, err
+	}
+	defer unlock()
+	ring := NewSession(locationID, accessToken)
+	defer ring.Close()
+	session, err := ring.Open()
+	if err != nil {
+		return DeviceCommandResult{}, err
+	}
+	devices, err := session.DeviceList()
+	if err != nil {
+		return DeviceCommandResult{}, err
+	}
+	// The typed list drops the commandTypes, so the message Ring sent is read again.
+	var message struct {
+		Body []commandBody `json:"body"`
+	}
+	if len(devices.Raw) == 0 {
+		return DeviceCommandResult{}, errNoRaw
+	}
+	if err := json.Unmarshal(devices.Raw, &message); err != nil {
+		return DeviceCommandResult{}, err
+	}
+	device, found := findDevice(message.Body, zidOrName)
+	if !found {
+		return DeviceCommandResult{}, &InvalidCommandError{fmt.Sprintf("no device %v", zidOrName)}
+	}
+	general := device.General.V2
+	result := DeviceCommandResult{ZID: general.ZID, Name: general.Name, Type: general.DeviceType}
+	if !contains(known.types, general.DeviceType) {
+		return result, &InvalidCommandError{fmt.Sprintf("%v is a %v, %v needs a %v", general.Name, general.DeviceType, command, strings.Join(known.types, " or "))}
+	}
+	if known.commandType != "" {
+		if _, supported := general.CommandTypes[known.commandType]; !supported {
+			return result, &InvalidCommandError{fmt.Sprintf("%v does not support %v", general.Name, known.commandType)}
+		}
+		err = session.Command(general.ZID, known.commandType, map[string]interface{}{})
+	} else {
+		fields := map[string]interface{}{"on": command != CommandSwitchOff}
+		if known.needsLevel {
+			// Ring keeps the level as a fraction, a level of 0 also turns the light off.
+			fields["level"] = float64(*level) / 100
+			fields["on"] = *level > 0
+		}
+		err = session.Set(general.ZID, []map[string]interface{}{{
+			"zid":    general.ZID,
+			"device": map[string]interface{}{"v1": fields},
+		}})
+	}
+	// The device state in the device snapshot is stale now.
+	ringCache.Delete(devicesCacheKey(locationID, accessToken))
+	return result, err
+}
+
+// findDevice returns the device with the zid, or else the name.
+func findDevice(devices []commandBody, zidOrName string) (commandBody, bool) {
+	for _, device := range devices {
+		if device.General.V2.ZID == zidOrName {
+			return device, true
+		}
+	}
+	for _, device := range devices {
+		if strings.EqualFold(device.General.V2.Name, zidOrName) {
+			return device, true
+		}
+	}
+	return commandBody{}, false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
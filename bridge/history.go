@@ -0,0 +1,58 @@
+package bridge
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+)
+
+// historyPageSize is the number of events read from Ring at a time.
+const historyPageSize = 50
+
+// EventType returns the impulse of a history event, or the adapter type when it has none.
+func EventType(history httputil.History) string {
+	if len(history.Body) == 0 {
+		return ""
+	}
+	if len(history.Body[0].Impulse.ImpulseTypes) > 0 {
+		return history.Body[0].Impulse.ImpulseTypes[0].ImpulseType
+	}
+	return history.Body[0].General.V2.AdapterType
+}
+
+// EventTime returns when a history event occurred.
+func EventTime(history httputil.History) time.Time {
+	return time.Unix(0, history.Context.EventOccurredTsMs*int64(time.Millisecond))
+}
+
+// History pages through the history of the location from the newest event
+// back to from, calling visit for every event between from and to.
+func History(locationID, accessToken string, from, to time.Time, visit func(httputil.History) error) error {
+	for offset := 0; ; offset += historyPageSize {
+		var page []httputil.History
+		err := ringRetry.Do("History request", func() error {
+			var err error
+			page, err = httputil.HistoryPageRequest("https://app.ring.com/api/v1/rs/history", accessToken, locationID, strconv.Itoa(offset), strconv.Itoa(historyPageSize))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, event := range page {
+			at := EventTime(event)
+			if at.Before(from) {
+				return nil
+			}
+			if at.After(to) {
+				continue
+			}
+			if err := visit(event); err != nil {
+				return err
+			}
+		}
+		if len(page) < historyPageSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
+)
+
+// Session opens at most one websocket connection to Ring for an action,
+// so the device list and any follow-up command share it.
+type Session struct {
+	locationID  string
+	accessToken string
+	session     *wsutil.Session
+}
+
+// NewSession creates a Session for the location. No connection is made until one is needed.
+func NewSession(locationID, accessToken string) *Session {
+	return &Session{locationID: locationID, accessToken: accessToken}
+}
+
+// Open returns the websocket session, connecting to Ring if needed.
+func (r *Session) Open() (*wsutil.Session, error) {
+	if r.session != nil {
+		return r.session, nil
+	}
+	err := ringRetry.Do("Websocket connection", func() error {
+		_, err := r.open()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.session, nil
+}
+
+// open connects once, for the retried calls that open the session themselves.
+func (r *Session) open() (*wsutil.Session, error) {
+	if r.session != nil {
+		return r.session, nil
+	}
+	connection, err := httputil.ConnectionRequest("https://app.ring.com/api/v1/rs/connections", r.locationID, r.accessToken)
+	if err != nil {
+		return nil, err
+	}
+	r.session, err = wsutil.Open(connection)
+	if err != nil {
+		r.session = nil
+		return nil, err
+	}
+	return r.session, nil
+}
+
+// Close closes the websocket connection, if one was opened.
+func (r *Session) Close() {
+	if r.session != nil {
+		r.session.Close()
+		r.session = nil
+	}
+}
+
+// Devices returns the device list, from the cache when there is a recent snapshot.
+func (r *Session) Devices() (*httputil.RingDeviceInfo, error) {
+	key := devicesCacheKey(r.locationID, r.accessToken)
+	if devices, ok := cachedDevices(key); ok {
+		return devices, nil
+	}
+
+	var devices *httputil.RingDeviceInfo
+	err := ringRetry.Do("Device list", func() error {
+		var err error
+		devices, err = r.deviceList()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	cacheDevices(key, devices)
+	return devices, nil
+}
+
+// cacheDevices keeps the device list as Ring sent it, so the fields the typed
+// list drops, e.g. the alarm state, are still in Raw when it is read back. A
+// list without Raw is not cached.
+func cacheDevices(key string, devices *httputil.RingDeviceInfo) {
+	if len(devices.Raw) > 0 {
+		ringCache.Set(key, devices.Raw, devicesTTL)
+	}
+}
+
+// cachedDevices returns the device list cached by cacheDevices.
+func cachedDevices(key string) (*httputil.RingDeviceInfo, bool) {
+	raw, ok := ringCache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var devices httputil.RingDeviceInfo
+	if err := json.Unmarshal(raw, &devices); err != nil {
+		return nil, false
+	}
+	devices.Raw = raw
+	return &devices, true
+}
+
+// ZID returns the zid used to switch the security panel mode. The zid is
+// returned as is when given, otherwise it is looked up from the device list.
+func (r *Session) ZID(zID string) (string, error) {
+	// log.Println("Reading the ZID")
+	key := "zid:" + r.locationID
+	if len(zID) == 0 && cache.GetJSON(ringCache, key, &zID) {
+		return zID, nil
+	}
+	if len(zID) == 0 {
+		ringDeviceInfo, err := r.Devices()
+		if err != nil {
+			log.Println(err)
+			return "", err
+		}
+		for i := range ringDeviceInfo.Body {
+			if ringDeviceInfo.Body[i].General.V2.DeviceType == "access-code" {
+				zID = ringDeviceInfo.Body[i].General.V2.AdapterZID
+			}
+		}
+		if len(zID) > 0 {
+			cache.SetJSON(ringCache, key, zID, zidTTL)
+		}
+	}
+	return zID, nil
+}
+
+// deviceList reads the device list once, on a new connection after a failure.
+func (r *Session) deviceList() (*httputil.RingDeviceInfo, error) {
+	session, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := session.DeviceList()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return devices, nil
+}
+
+// PanelMode reads the current mode of the security panel from a fresh device list.
+func (r *Session) PanelMode() (string, error) {
+	ringCache.Delete(devicesCacheKey(r.locationID, r.accessToken))
+	devices, err := r.Devices()
+	if err != nil {
+		return "", err
+	}
+	return panelMode(devices)
+}
+
+func panelMode(devices *httputil.RingDeviceInfo) (string, error) {
+	for i := range devices.Body {
+		if devices.Body[i].General.V2.DeviceType == "security-panel" {
+			return devices.Body[i].Device.V1.Mode, nil
+		}
+	}
+	return "", errors.New("no security panel found")
+}
+
+// SetMode switches the security panel to the mode and reports whether it was
+// sent. Nothing is sent when the panel is already in the mode. A failed switch
+// may still have reached Ring, so it is only sent again after the panel is
+// confirmed to be in another mode.
+func (r *Session) SetMode(zID string, mode string) (bool, error) {
+	attempt := 0
+	changed := false
+	// Each attempt reads the mode and switches it within the one retry, a
+	// nested retry on the same breaker would fail while it is probing.
+	err := ringRetry.Do("Mode change", func() error {
+		attempt++
+		current, err := r.currentMode()
+		if err != nil && attempt > 1 {
+			return err
+		}
+		if err != nil {
+			log.Printf("Unable to read the security panel mode, setting it anyway - %v", err)
+		}
+		if err == nil && current == mode {
+			httputil.Trace.Printf("Security panel is already in mode %v", mode)
+			return nil
+		}
+		changed = true
+		session, err := r.open()
+		if err != nil {
+			return err
+		}
+		err = session.SetMode(zID, mode)
+		if err != nil {
+			r.Close()
+		}
+		return err
+	})
+	return changed, err
+}
+
+// currentMode reads the panel mode once, without the device cache.
+func (r *Session) currentMode() (string, error) {
+	devices, err := r.deviceList()
+	if err != nil {
+		return "", err
+	}
+	return panelMode(devices)
+}
@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+)
+
+func makeTimestamp() int64 {
+	return time.Now().UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
+}
+
+// Status returns the state of every device in the location with the latest history events.
+func Status(locationID, accessToken string, historyLimit int) (public.DeviceResponse, error) {
+	httputil.Trace.Printf("LocationID %v", locationID)
+
+	// History and devices come from different Ring services, fetch them at the same time.
+	var (
+		wg             sync.WaitGroup
+		history        []httputil.History
+		historyErr     error
+		ringDeviceInfo *httputil.RingDeviceInfo
+		devicesErr     error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		historyErr = ringRetry.Do("History request", func() error {
+			var err error
+			history, err = httputil.HistoryRequest("https://app.ring.com/api/v1/rs/history", accessToken, locationID, strconv.Itoa(historyLimit))
+			return err
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		ringDeviceInfo, devicesErr = Devices(locationID, accessToken)
+	}()
+	wg.Wait()
+
+	if historyErr != nil {
+		log.Println("Error while trying to get Ring devices History.")
+		return public.DeviceResponse{}, historyErr
+	}
+	if devicesErr != nil {
+		log.Println("Error while trying to get Ring Devices.")
+		return public.DeviceResponse{}, devicesErr
+	}
+	return statusResponse(ringDeviceInfo, history), nil
+}
+
+// statusResponse builds the status of the device list and history events.
+func statusResponse(ringDeviceInfo *httputil.RingDeviceInfo, history []httputil.History) public.DeviceResponse {
+	var ringEvents []public.RingDeviceEvent
+
+	// Adding Refresh time Event
+	ringEvents = append(ringEvents, public.RingDeviceEvent{DeviceName: "Ring Alarm", Time: makeTimestamp(), Type: "Refresh"})
+
+	for i := range history {
+		//result, _ := json.Marshal(history[i])
+		//log.Printf("Histoy - %v", string(result))
+		//log.Printf("Device: %s, Time : %v, Type: %s\n", history[i].Context.AffectedEntityName, time.Unix(0, history[i].Context.EventOccurredTsMs*int64(time.Millisecond)), history[i].Body[0].Impulse.ImpulseTypes[0].ImpulseType)
+		ringEvents = append(ringEvents, public.RingDeviceEvent{DeviceName: history[i].Context.AffectedEntityName, Time: history[i].Context.EventOccurredTsMs, Type: EventType(history[i])})
+	}
+
+	var deviceStatus []public.RingDeviceStatus
+	for i := range ringDeviceInfo.Body {
+		// log.Printf("RDName: %s, Type: %s, Fault: %v, Mode: %s\n", ringDeviceInfo.Body[i].General.V2.Name, ringDeviceInfo.Body[i].General.V2.DeviceType, ringDeviceInfo.Body[i].Device.V1.Faulted, ringDeviceInfo.Body[i].Device.V1.Mode)
+		deviceStatus = append(deviceStatus, public.RingDeviceStatus{ID: ringDeviceInfo.Body[i].General.V2.ZID, Name: ringDeviceInfo.Body[i].General.V2.Name, Type: ringDeviceInfo.Body[i].General.V2.DeviceType, Faulted: ringDeviceInfo.Body[i].Device.V1.Faulted, Mode: ringDeviceInfo.Body[i].Device.V1.Mode, LastUpdate: ringDeviceInfo.Body[i].General.V2.LastUpdate})
+	}
+
+	return public.DeviceResponse{DeviceStatus: deviceStatus, Events: ringEvents, Version: alarmstate.NewSnapshot(ringDeviceInfo).Version()}
+}
+
+// ETag identifies the devices and history of the status, leaving out the
+// Refresh event, which is new on every call. view names what else shapes the
+// answer, such as since and the history limit, so answers of differently
+// shaped requests never share an ETag.
+func ETag(status public.DeviceResponse, view string) string {
+	var newest int64
+	for _, event := range status.Events {
+		if event.Type != "Refresh" && event.Time > newest {
+			newest = event.Time
+		}
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(view))
+	return `"` + status.Version + "-" + strconv.FormatInt(newest, 36) + "-" + strconv.FormatUint(uint64(hash.Sum32()), 36) + `"`
+}
+
+// Delta keeps the devices Ring updated and the events that happened after
+// since, in milliseconds, and the Refresh event. Ring also updates a device
+// when it checks in, so a delta can hold devices that did not change.
+func Delta(status public.DeviceResponse, since int64) public.DeviceResponse {
+	var devices []public.RingDeviceStatus
+	for _, device := range status.DeviceStatus {
+		if device.LastUpdate > since {
+			devices = append(devices, device)
+		}
+	}
+	var events []public.RingDeviceEvent
+	for _, event := range status.Events {
+		if event.Type == "Refresh" || event.Time > since {
+			events = append(events, event)
+		}
+	}
+	status.DeviceStatus, status.Events, status.Delta = devices, events, true
+	return status
+}
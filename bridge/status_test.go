@@ -0,0 +1,34 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+)
+
+func TestETag(t *testing.T) {
+	status := public.DeviceResponse{
+		Version: "v1",
+		Events:  []public.RingDeviceEvent{{Type: "Refresh", Time: 300}, {Type: "Motion", Time: 200}},
+	}
+	etag := ETag(status, "since=0&limit=5&history=true")
+
+	refreshed := status
+	refreshed.Events = []public.RingDeviceEvent{{Type: "Refresh", Time: 400}, {Type: "Motion", Time: 200}}
+	if got := ETag(refreshed, "since=0&limit=5&history=true"); got != etag {
+		t.Errorf("ETag() after a refresh = %v, want %v", got, etag)
+	}
+
+	changed := map[string]string{
+		"devices":    ETag(public.DeviceResponse{Version: "v2", Events: status.Events}, "since=0&limit=5&history=true"),
+		"history":    ETag(public.DeviceResponse{Version: "v1", Events: []public.RingDeviceEvent{{Type: "Motion", Time: 250}}}, "since=0&limit=5&history=true"),
+		"since":      ETag(status, "since=100&limit=5&history=true"),
+		"limit":      ETag(status, "since=0&limit=1&history=true"),
+		"no history": ETag(status, "since=0&limit=5&history=false"),
+	}
+	for name, got := range changed {
+		if got == etag {
+			t.Errorf("ETag() with other %v = %v, the same as before", name, got)
+		}
+	}
+}
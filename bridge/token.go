@@ -0,0 +1,79 @@
+package bridge
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// AccessTokenTTL is how long a TokenSource reuses an access token, Ring issues them for an hour.
+var AccessTokenTTL = 30 * time.Minute
+
+// TokenSource hands out access tokens for a refresh token kept in a store. Ring
+// returns a new refresh token with every exchange, it is written back to the store.
+type TokenSource struct {
+	// Load reads the refresh token from the store.
+	Load func() (string, error)
+	// Save writes a new refresh token to the store, nil keeps it in memory only.
+	Save func(refreshToken string) error
+
+	mu           sync.Mutex
+	refreshToken string
+	accessToken  string
+	expires      time.Time
+}
+
+// AccessToken returns the current access token, exchanging the refresh token
+// when it expired. When Ring refuses the refresh token it is read again from
+// the store once, another instance may have rotated it.
+func (t *TokenSource) AccessToken() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.accessToken != "" && time.Now().Before(t.expires) {
+		return t.accessToken, nil
+	}
+
+	reloaded := false
+	if t.refreshToken == "" {
+		if err := t.load(); err != nil {
+			return "", err
+		}
+		reloaded = true
+	}
+	accessToken, refreshToken, err := AccessToken(t.refreshToken)
+	if err == ErrAccessDenied && !reloaded {
+		log.Println("Ring refused the refresh token, reading it again from the store")
+		if err := t.load(); err != nil {
+			return "", err
+		}
+		accessToken, refreshToken, err = AccessToken(t.refreshToken)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if refreshToken != "" && refreshToken != t.refreshToken {
+		t.refreshToken = refreshToken
+		if t.Save != nil {
+			if err := t.Save(refreshToken); err != nil {
+				log.Printf("Unable to store the new refresh token - %v", err)
+			}
+		}
+	}
+	t.accessToken = accessToken
+	t.expires = time.Now().Add(AccessTokenTTL)
+	return accessToken, nil
+}
+
+func (t *TokenSource) load() error {
+	refreshToken, err := t.Load()
+	if err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return errors.New("no refresh token in the store")
+	}
+	t.refreshToken = refreshToken
+	return nil
+}
@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
+)
+
+// WaitStatus returns the status of the location as soon as it differs from
+// what the client knows: a version other than the one of the devices, or a
+// history event after since (milliseconds). Without either it returns at once.
+// Otherwise it waits up to timeout for a device to change, and Changed of the
+// response is false when none did.
+func WaitStatus(locationID, accessToken string, historyLimit int, version string, since int64, timeout time.Duration) (public.DeviceResponse, error) {
+	httputil.Trace.Printf("LocationID %v, waiting up to %v for a change of version %q since %v", locationID, timeout, version, since)
+
+	ring := NewSession(locationID, accessToken)
+	defer ring.Close()
+	session, err := ring.Open()
+	if err != nil {
+		return public.DeviceResponse{}, err
+	}
+	// Subscribe before reading the devices, so no update falls in between.
+	updates, cancel := session.Subscribe()
+	defer cancel()
+
+	devices, history, err := currentStatus(session, locationID, accessToken, historyLimit)
+	if err != nil {
+		return public.DeviceResponse{}, err
+	}
+	response := statusResponse(devices, history)
+	changed := (version == "" && since == 0) || (version != "" && response.Version != version) || newerThan(history, since)
+
+	if !changed {
+		tracker := alarmstate.NewTracker(devices)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+	wait:
+		for {
+			select {
+			case <-timer.C:
+				break wait
+			case update, ok := <-updates:
+				if !ok {
+					if err := session.Err(); err != nil {
+						return public.DeviceResponse{}, err
+					}
+					return public.DeviceResponse{}, errors.New("connection closed")
+				}
+				if len(tracker.Apply(update)) > 0 {
+					changed = true
+					break wait
+				}
+			}
+		}
+		if changed {
+			// Read everything again, the update only holds the fields that changed.
+			devices, history, err = currentStatus(session, locationID, accessToken, historyLimit)
+			if err != nil {
+				return public.DeviceResponse{}, err
+			}
+			response = statusResponse(devices, history)
+		}
+	}
+
+	cacheDevices(devicesCacheKey(locationID, accessToken), devices)
+	response.Changed = &changed
+	return response, nil
+}
+
+// currentStatus reads the device list over the session and the history at the same time.
+func currentStatus(session *wsutil.Session, locationID, accessToken string, historyLimit int) (*httputil.RingDeviceInfo, []httputil.History, error) {
+	var (
+		wg         sync.WaitGroup
+		history    []httputil.History
+		historyErr error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		historyErr = ringRetry.Do("History request", func() error {
+			var err error
+			history, err = httputil.HistoryRequest("https://app.ring.com/api/v1/rs/history", accessToken, locationID, strconv.Itoa(historyLimit))
+			return err
+		})
+	}()
+	devices, err := session.DeviceList()
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+	return devices, history, historyErr
+}
+
+// newerThan reports whether any history event happened after since, in milliseconds.
+func newerThan(history []httputil.History, since int64) bool {
+	if since == 0 {
+		return false
+	}
+	for i := range history {
+		if history[i].Context.EventOccurredTsMs > since {
+			return true
+		}
+	}
+	return false
+}
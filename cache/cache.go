@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps values for a limited time. Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value for the key, or false if it is missing or expired.
+	Get(key string) ([]byte, bool)
+	// Set stores the value for the key for the ttl.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the key.
+	Delete(key string)
+}
+
+// Shared is a Store every instance of the bridge sees, with writes that only
+// succeed when the key holds what is expected. Locks, used codes and failure
+// counts need one once more than one Lambda instance answers requests.
+type Shared interface {
+	Store
+	// Add stores the value only when the key is missing or expired, and
+	// reports whether it did.
+	Add(key string, value []byte, ttl time.Duration) (bool, error)
+	// DeleteValue removes the key only while it still holds the value.
+	DeleteValue(key string, value []byte) error
+	// Increment adds one to the counter of the key and returns the new count.
+	// A missing or expired counter starts from zero. The counter expires ttl
+	// after the last increment.
+	Increment(key string, ttl time.Duration) (int64, error)
+}
+
+// New creates a Store from a spec:
+//
+//	memory            - in process memory, kept across warm Lambda invocations (default)
+//	file:<dir>        - one file per key under dir, kept across processes
+//	dynamodb:<table>  - one item per key in a table with the string keys pk and sk, a Shared store
+//	none              - nothing is cached
+func New(spec string) (Store, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewMemoryStore(), nil
+	case spec == "none":
+		return noStore{}, nil
+	case strings.HasPrefix(spec, "file:"):
+		return NewFileStore(strings.TrimPrefix(spec, "file:"))
+	case strings.HasPrefix(spec, "dynamodb:") && len(spec) > len("dynamodb:"):
+		return &DynamoDBStore{Table: strings.TrimPrefix(spec, "dynamodb:")}, nil
+	default:
+		return nil, fmt.Errorf("cache: unknown store %q", spec)
+	}
+}
+
+// GetJSON decodes the cached value for the key into v. It returns false when
+// the key is missing or the value can not be decoded.
+func GetJSON(store Store, key string, v interface{}) bool {
+	data, ok := store.Get(key)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		log.Printf("Ignoring unreadable cache entry %v - %v", key, err)
+		return false
+	}
+	return true
+}
+
+// SetJSON stores v encoded as JSON for the ttl.
+func SetJSON(store Store, key string, v interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Unable to cache %v - %v", key, err)
+		return
+	}
+	store.Set(key, data, ttl)
+}
+
+// addMu makes Add and Increment atomic within the process for stores that are not Shared.
+var addMu sync.Mutex
+
+// Add stores the value only when the key is missing or expired, and reports
+// whether it did. It is atomic across processes for a Shared store, and only
+// within the process otherwise.
+func Add(store Store, key string, value []byte, ttl time.Duration) (bool, error) {
+	if shared, ok := store.(Shared); ok {
+		return shared.Add(key, value, ttl)
+	}
+	addMu.Lock()
+	defer addMu.Unlock()
+	if _, found := store.Get(key); found {
+		return false, nil
+	}
+	store.Set(key, value, ttl)
+	return true, nil
+}
+
+// Increment adds one to the counter of the key and returns the new count. The
+// counter expires ttl after the last increment. It is atomic across processes
+// for a Shared store, and only within the process otherwise.
+func Increment(store Store, key string, ttl time.Duration) (int64, error) {
+	if shared, ok := store.(Shared); ok {
+		return shared.Increment(key, ttl)
+	}
+	addMu.Lock()
+	defer addMu.Unlock()
+	var count int64
+	if data, found := store.Get(key); found {
+		count, _ = strconv.ParseInt(string(data), 10, 64)
+	}
+	count++
+	store.Set(key, []byte(strconv.FormatInt(count, 10)), ttl)
+	return count, nil
+}
+
+type noStore struct{}
+
+func (noStore) Get(key string) ([]byte, bool)                   { return nil, false }
+func (noStore) Set(key string, value []byte, ttl time.Duration) {}
+func (noStore) Delete(key string)                               {}
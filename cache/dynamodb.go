@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoDBStore keeps every value as an item with pk "cache#<key>" and sk
+// "value". The keys match the audit log table, so both can share one table.
+// The expires attribute holds the unix time the value expires, it can be the
+// TTL attribute of the table.
+type DynamoDBStore struct {
+	Table string
+	// Client is created from the environment when nil.
+	Client dynamodbiface.DynamoDBAPI
+}
+
+func (s *DynamoDBStore) client() (dynamodbiface.DynamoDBAPI, error) {
+	if s.Client == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		s.Client = dynamodb.New(sess)
+	}
+	return s.Client, nil
+}
+
+func (s *DynamoDBStore) key(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String("cache#" + key)},
+		"sk": {S: aws.String("value")},
+	}
+}
+
+func (s *DynamoDBStore) item(key string, value []byte, ttl time.Duration) map[string]*dynamodb.AttributeValue {
+	item := s.key(key)
+	item["value"] = &dynamodb.AttributeValue{B: value}
+	item["expires"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))}
+	return item
+}
+
+// Get implements Store. DynamoDB deletes expired items late, so the expiry is checked as well.
+func (s *DynamoDBStore) Get(key string) ([]byte, bool) {
+	client, err := s.client()
+	if err != nil {
+		log.Println("Unable to read cache entry: ", err)
+		return nil, false
+	}
+	output, err := client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.Table),
+		Key:            s.key(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		log.Println("Unable to read cache entry: ", err)
+		return nil, false
+	}
+	value, ok := output.Item["value"]
+	if !ok || expired(output.Item) {
+		return nil, false
+	}
+	return value.B, true
+}
+
+// Set implements Store.
+func (s *DynamoDBStore) Set(key string, value []byte, ttl time.Duration) {
+	client, err := s.client()
+	if err == nil {
+		_, err = client.PutItem(&dynamodb.PutItemInput{TableName: aws.String(s.Table), Item: s.item(key, value, ttl)})
+	}
+	if err != nil {
+		log.Println("Unable to write cache entry: ", err)
+	}
+}
+
+// Delete implements Store.
+func (s *DynamoDBStore) Delete(key string) {
+	client, err := s.client()
+	if err == nil {
+		_, err = client.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String(s.Table), Key: s.key(key)})
+	}
+	if err != nil {
+		log.Println("Unable to delete cache entry: ", err)
+	}
+}
+
+// Add implements Shared with a conditional put.
+func (s *DynamoDBStore) Add(key string, value []byte, ttl time.Duration) (bool, error) {
+	client, err := s.client()
+	if err != nil {
+		return false, err
+	}
+	_, err = client.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(s.Table),
+		Item:                s.item(key, value, ttl),
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expires <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(time.Now().Unix(), 10))},
+		},
+	})
+	if conditionFailed(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeleteValue implements Shared with a conditional delete.
+func (s *DynamoDBStore) DeleteValue(key string, value []byte) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:                 aws.String(s.Table),
+		Key:                       s.key(key),
+		ConditionExpression:       aws.String("#value = :value"),
+		ExpressionAttributeNames:  map[string]*string{"#value": aws.String("value")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":value": {B: value}},
+	})
+	if conditionFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// Increment implements Shared. A live counter is updated with ADD, a missing or
+// expired one is replaced with a conditional put. When another instance puts
+// the counter first the update is tried again.
+func (s *DynamoDBStore) Increment(key string, ttl time.Duration) (int64, error) {
+	client, err := s.client()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+		output, err := client.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                aws.String(s.Table),
+			Key:                      s.key(key),
+			UpdateExpression:         aws.String("ADD #count :one SET expires = :expires"),
+			ConditionExpression:      aws.String("expires > :now"),
+			ExpressionAttributeNames: map[string]*string{"#count": aws.String("count")},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":one":     {N: aws.String("1")},
+				":expires": {N: aws.String(expires)},
+				":now":     {N: aws.String(now)},
+			},
+			ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+		})
+		if err == nil {
+			count, ok := output.Attributes["count"]
+			if !ok || count.N == nil {
+				return 0, fmt.Errorf("cache: %v has no count", key)
+			}
+			return strconv.ParseInt(*count.N, 10, 64)
+		}
+		if !conditionFailed(err) {
+			return 0, err
+		}
+
+		item := s.key(key)
+		item["count"] = &dynamodb.AttributeValue{N: aws.String("1")}
+		item["expires"] = &dynamodb.AttributeValue{N: aws.String(expires)}
+		_, err = client.PutItem(&dynamodb.PutItemInput{
+			TableName:           aws.String(s.Table),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(pk) OR expires <= :now"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":now": {N: aws.String(now)},
+			},
+		})
+		if err == nil {
+			return 1, nil
+		}
+		if !conditionFailed(err) {
+			return 0, err
+		}
+	}
+}
+
+func (s *DynamoDBStore) String() string { return "dynamodb " + s.Table }
+
+// expired reports whether the expires attribute of the item has passed.
+func expired(item map[string]*dynamodb.AttributeValue) bool {
+	value, ok := item["expires"]
+	if !ok || value.N == nil {
+		return false
+	}
+	expires, err := strconv.ParseInt(*value.N, 10, 64)
+	return err == nil && time.Now().Unix() >= expires
+}
+
+func conditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
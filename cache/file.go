@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileEntry struct {
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+// FileStore keeps every value in its own file under a directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore, creating the directory if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get implements Store.
+func (s *FileStore) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry fileEntry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Now().After(entry.Expires) {
+		s.Delete(key)
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Set implements Store. The value is written to a temporary file first so a
+// concurrent reader never sees a partial entry.
+func (s *FileStore) Set(key string, value []byte, ttl time.Duration) {
+	data, err := json.Marshal(fileEntry{Expires: time.Now().Add(ttl), Value: value})
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(s.dir, "entry-")
+	if err != nil {
+		log.Println("Unable to write cache entry: ", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err != nil || closeErr != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		log.Println("Unable to write cache entry: ", err)
+		os.Remove(tmp.Name())
+	}
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(key string) {
+	os.Remove(s.path(key))
+}
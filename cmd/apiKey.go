@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/apikey"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/spf13/cobra"
+)
+
+// apiKeyCmd represents the apiKey command
+var apiKeyCmd = &cobra.Command{
+	Use:   "apiKey",
+	Short: "Manage the scoped API keys of the bridge",
+	Long: `Adds, lists and revokes the API keys the bridge checks before running an action. 
+Each key has scopes, a key without the scope of an action gets 403:
+
+  status:read     status, status/wait, and /events and /ws of serve
+  history:read    the history events of status
+  arm             home and away
+  disarm          off
+  devices:read    meta and devices
+  audit:read      audit
+  codes:read      codes
+  codes:write     codes/add, codes/update and codes/remove
+  devices:control device/{zid}/command
+
+The keys are kept in a secrets backend, the RING_API_KEYS of the Lambda 
+(ssm:<parameter name> or secretsmanager:<secret id>) or the server.apiKeys of 
+serve (file:<path>). --keys defaults to server.apiKeys of the config profile.`,
+}
+
+var apiKeyAddCmd = &cobra.Command{
+	Use:          "add <name>",
+	Short:        "Create a new API key and print it",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, keys, err := apiKeys(cmd)
+		if err != nil {
+			return err
+		}
+		if _, ok := keys.Find(args[0]); ok {
+			return fmt.Errorf("API key %v already exists, revoke it or pick another name", args[0])
+		}
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		key, token, err := apikey.NewKey(args[0], scopes)
+		if err != nil {
+			return err
+		}
+		keys.Keys = append(keys.Keys, key)
+		err = apikey.SaveKeys(backend, keys)
+		auditCLI("apikey-add", err, key.Name+" "+strings.Join(key.Scopes, ","))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added API key %v (%v) to %v.\nAPI Key - %v\n\n", key.Name, strings.Join(key.Scopes, ", "), backend, token)
+		fmt.Println("*** WARNING *** \n The key is not shown again. Send it as the header \"Authorization: Bearer <API Key>\".")
+		return nil
+	},
+}
+
+var apiKeyListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the API keys",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, keys, err := apiKeys(cmd)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPES\tCREATED\tREVOKED")
+		for _, key := range keys.Keys {
+			revoked := "-"
+			if key.Revoked != nil {
+				revoked = key.Revoked.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", key.Name, strings.Join(key.Scopes, ","), key.Created.Local().Format(time.RFC3339), revoked)
+		}
+		return w.Flush()
+	},
+}
+
+var apiKeyRevokeCmd = &cobra.Command{
+	Use:          "revoke <name>",
+	Short:        "Revoke an API key",
+	Long:         `Revokes the key. The bridge stops accepting it once it reads the keys again, within a minute.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, keys, err := apiKeys(cmd)
+		if err != nil {
+			return err
+		}
+		found := false
+		for i, key := range keys.Keys {
+			if key.Name == args[0] && key.Revoked == nil {
+				now := time.Now().UTC()
+				keys.Keys[i].Revoked = &now
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no active API key %v", args[0])
+		}
+		err = apikey.SaveKeys(backend, keys)
+		auditCLI("apikey-revoke", err, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked API key %v in %v.\n", args[0], backend)
+		return nil
+	},
+}
+
+// apiKeys reads the keys of the --keys backend. A missing file holds no keys.
+func apiKeys(cmd *cobra.Command) (secrets.Backend, apikey.KeySet, error) {
+	spec := flagOrProfile(cmd, "keys", profile.Server.APIKeys)
+	if spec == "" {
+		return nil, apikey.KeySet{}, errors.New("no API keys backend, use --keys or set server.apiKeys in the config profile")
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return nil, apikey.KeySet{}, err
+	}
+	keys, err := apikey.LoadKeys(backend)
+	if _, isFile := backend.(secrets.File); isFile && os.IsNotExist(err) {
+		return backend, apikey.KeySet{}, nil
+	}
+	return backend, keys, err
+}
+
+func init() {
+	rootCmd.AddCommand(apiKeyCmd)
+	apiKeyCmd.AddCommand(apiKeyAddCmd)
+	apiKeyCmd.AddCommand(apiKeyListCmd)
+	apiKeyCmd.AddCommand(apiKeyRevokeCmd)
+
+	apiKeyCmd.PersistentFlags().String("keys", "", "Secrets backend of the API keys (default is server.apiKeys of the config profile)")
+	apiKeyAddCmd.Flags().StringSlice("scope", nil, "Scope of the key, repeat or comma separate: "+strings.Join(apikey.AllScopes, ", "))
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/spf13/cobra"
+)
+
+// armCmd represents the arm command
+var armCmd = &cobra.Command{
+	Use:          "arm",
+	Short:        "Arm the Ring Alarm in home or away mode",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mode := cmd.Flag("mode").Value.String()
+		if mode != "home" && mode != "away" {
+			return fmt.Errorf("invalid mode %q, use home or away", mode)
+		}
+		return switchMode(cmd, mode)
+	},
+}
+
+// disarmCmd represents the disarm command
+var disarmCmd = &cobra.Command{
+	Use:          "disarm",
+	Short:        "Disarm the Ring Alarm",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return switchMode(cmd, "off")
+	},
+}
+
+func switchMode(cmd *cobra.Command, action string) error {
+	account, err := login(cmd)
+	if err != nil {
+		return err
+	}
+	mode := bridge.Modes[action]
+	changed, err := bridge.SetMode(account.locationID, account.accessToken, account.zID, mode)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Printf("Ring Alarm is already %v, no change\n", bridge.ModeName(mode))
+		return nil
+	}
+	fmt.Printf("Ring Alarm is now %v\n", bridge.ModeName(mode))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(armCmd)
+	rootCmd.AddCommand(disarmCmd)
+
+	addRingFlags(armCmd)
+	armCmd.Flags().StringP("mode", "m", "away", "Mode to arm in (home or away)")
+	addRingFlags(disarmCmd)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of the bridge",
+	Long: `Shows the commands issued through the bridge (home, away and off) and the 
+credential operations, newest first, with the API key, source IP, result and 
+latency of each.
+
+--log reads another audit log than the auditLog of the config profile, e.g. 
+dynamodb:<table> for the RING_AUDIT_LOG of the Lambda.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showAudit(cmd)
+	},
+}
+
+func showAudit(cmd *cobra.Command) error {
+	output := cmd.Flag("output").Value.String()
+	if output != "table" && output != "json" && output != "yaml" && output != "csv" {
+		return fmt.Errorf("unknown output format %q, use table, json, yaml or csv", output)
+	}
+	spec, err := homedir.Expand(flagOrProfile(cmd, "log", profile.AuditLog))
+	if err != nil {
+		return err
+	}
+	sink, err := audit.New(spec)
+	if err != nil {
+		return err
+	}
+
+	filter := audit.Filter{Action: cmd.Flag("action").Value.String()}
+	filter.Limit, _ = cmd.Flags().GetInt("limit")
+	if filter.From, err = parseHistoryDate(cmd.Flag("from").Value.String(), time.Local, time.Time{}, false); err != nil {
+		return err
+	}
+	if filter.To, err = parseHistoryDate(cmd.Flag("to").Value.String(), time.Local, time.Time{}, false); err != nil {
+		return err
+	}
+	events, err := sink.Query(filter)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"time", "action", "result", "key", "sourceIp", "locationId", "latencyMs", "detail"}
+	var rows [][]string
+	for _, event := range events {
+		key := event.KeyName
+		if key == "" {
+			key = "-"
+		}
+		rows = append(rows, []string{event.Time.Local().Format(time.RFC3339), event.Action, event.Result, key, event.SourceIP, event.LocationID, strconv.FormatInt(event.LatencyMs, 10), event.Detail})
+	}
+	if events == nil {
+		events = []audit.Event{}
+	}
+	return writeOutput(output, events, headers, rows)
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().String("log", "", "Audit log to read (default is the auditLog of the config profile)")
+	auditCmd.Flags().String("from", "", "Only events from this date (YYYY-MM-DD) or RFC 3339 time")
+	auditCmd.Flags().String("to", "", "Only events before this date (YYYY-MM-DD) or RFC 3339 time")
+	auditCmd.Flags().String("action", "", "Only events of this action, e.g. off or token-rotate")
+	auditCmd.Flags().IntP("limit", "n", audit.DefaultLimit, "Most events to show")
+	auditCmd.Flags().StringP("output", "o", "table", "Output format (table, json, yaml or csv)")
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/spf13/cobra"
+)
+
+// codesCmd represents the codes command
+var codesCmd = &cobra.Command{
+	Use:   "codes",
+	Short: "Manage the keypad access codes",
+	Long: `Lists, adds, updates and removes the codes that disarm the Ring Alarm from the
+keypad, each with the name of its user. Ring never returns the digits of a code.
+
+A temporary code only works between --start and --end (RFC 3339 times), or for
+--for from now, e.g. a dog walker for the afternoon:
+
+  ./main codes add "Dog walker" --code 4711 --for 4h`,
+}
+
+var codesListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the access codes",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		account, err := login(cmd)
+		if err != nil {
+			return err
+		}
+		codes, err := bridge.AccessCodes(account.locationID, account.accessToken)
+		if err != nil {
+			return err
+		}
+		headers := []string{"name", "id", "start", "end"}
+		var rows [][]string
+		for _, code := range codes {
+			rows = append(rows, []string{code.Name, code.ID, code.Start, code.End})
+		}
+		return writeOutput(flagOrProfile(cmd, "output", profile.Output), codes, headers, rows)
+	},
+}
+
+var codesAddCmd = &cobra.Command{
+	Use:          "add <name>",
+	Short:        "Add an access code for a user",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, err := codeFlags(cmd)
+		if err != nil {
+			return err
+		}
+		code.Name = args[0]
+		account, err := login(cmd)
+		if err != nil {
+			return err
+		}
+		added, err := bridge.AddAccessCode(account.locationID, account.accessToken, code)
+		auditCLI("code-add", err, code.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added the code of %v%v.\n", added.Name, codeRange(added))
+		return nil
+	},
+}
+
+var codesUpdateCmd = &cobra.Command{
+	Use:          "update <name or id>",
+	Short:        "Change the name, digits or time range of an access code",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, err := codeFlags(cmd)
+		if err != nil {
+			return err
+		}
+		code.Name, _ = cmd.Flags().GetString("name")
+		account, err := login(cmd)
+		if err != nil {
+			return err
+		}
+		updated, err := bridge.UpdateAccessCode(account.locationID, account.accessToken, args[0], code)
+		auditCLI("code-update", err, args[0]+" "+code.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Updated the code of %v%v.\n", updated.Name, codeRange(updated))
+		return nil
+	},
+}
+
+var codesRemoveCmd = &cobra.Command{
+	Use:          "remove <name or id>",
+	Short:        "Remove an access code",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		account, err := login(cmd)
+		if err != nil {
+			return err
+		}
+		removed, err := bridge.RemoveAccessCode(account.locationID, account.accessToken, args[0])
+		auditCLI("code-remove", err, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed the code of %v.\n", removed.Name)
+		return nil
+	},
+}
+
+// codeFlags reads --code, --start, --end and --for.
+func codeFlags(cmd *cobra.Command) (public.AccessCode, error) {
+	var code public.AccessCode
+	code.Code, _ = cmd.Flags().GetString("code")
+	code.Start, _ = cmd.Flags().GetString("start")
+	code.End, _ = cmd.Flags().GetString("end")
+	duration, _ := cmd.Flags().GetDuration("for")
+	if duration != 0 {
+		if code.Start != "" || code.End != "" {
+			return code, errors.New("use either --for or --start and --end")
+		}
+		now := time.Now()
+		code.Start, code.End = now.Format(time.RFC3339), now.Add(duration).Format(time.RFC3339)
+	}
+	return code, nil
+}
+
+func codeRange(code public.AccessCode) string {
+	if code.End == "" {
+		return ""
+	}
+	return fmt.Sprintf(", valid from %v until %v", code.Start, code.End)
+}
+
+func init() {
+	rootCmd.AddCommand(codesCmd)
+	codesCmd.AddCommand(codesListCmd)
+	codesCmd.AddCommand(codesAddCmd)
+	codesCmd.AddCommand(codesUpdateCmd)
+	codesCmd.AddCommand(codesRemoveCmd)
+
+	for _, command := range []*cobra.Command{codesListCmd, codesAddCmd, codesUpdateCmd, codesRemoveCmd} {
+		addRingFlags(command)
+	}
+	codesListCmd.Flags().StringP("output", "o", "table", "Output format (table, json, yaml or csv, default is the output of the config profile)")
+	for _, command := range []*cobra.Command{codesAddCmd, codesUpdateCmd} {
+		command.Flags().String("code", "", "Digits of the code, 4 to 8")
+		command.Flags().String("start", "", "Start of a temporary code (RFC 3339)")
+		command.Flags().String("end", "", "End of a temporary code (RFC 3339)")
+		command.Flags().Duration("for", 0, "Make the code temporary, from now for this long, e.g. 4h")
+	}
+	codesAddCmd.MarkFlagRequired("code")
+	codesUpdateCmd.Flags().String("name", "", "New user name of the code")
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/config"
+	"github.com/asishrs/smartthings-ringalarmv2/credstore"
+	"github.com/asishrs/smartthings-ringalarmv2/recorder"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// passphraseEnv holds the passphrase of the credential file for scripts and serve.
+const passphraseEnv = config.EnvPrefix + "PASSPHRASE"
+
+// errNoRefreshToken is returned when neither a flag, the profile nor the credential store has a refresh token.
+var errNoRefreshToken = errors.New("no refresh token, log in with getRefreshKey or use --refreshToken, RING_BRIDGE_REFRESH_TOKEN or the refreshToken of the config profile")
+
+var passphrase string
+
+// credentialStore opens the credential store of the config profile.
+func credentialStore() (credstore.Store, error) {
+	return credstore.Open(credstore.Options{
+		Store:      profile.Credentials.Store,
+		File:       profile.Credentials.File,
+		KeyFile:    profile.Credentials.KeyFile,
+		Passphrase: askPassphrase,
+	})
+}
+
+// askPassphrase returns RING_BRIDGE_PASSPHRASE or asks for the passphrase once on the terminal.
+func askPassphrase() (string, error) {
+	if value, ok := os.LookupEnv(passphraseEnv); ok {
+		return value, nil
+	}
+	if passphrase != "" {
+		return passphrase, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("the credential file needs a passphrase, set %v or use a credentials.keyFile", passphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Credential file passphrase: ")
+	value, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	passphrase = string(value)
+	return passphrase, nil
+}
+
+// resolveRefreshToken returns the refresh token of the flag, the config profile or the
+// credential store, and the store when the token came from it.
+func resolveRefreshToken(command *cobra.Command) (string, credstore.Store, error) {
+	if token := flagOrProfile(command, "refreshToken", profile.RefreshToken); token != "" {
+		return token, nil, nil
+	}
+	store, err := credentialStore()
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := store.Get(profile.Name)
+	if err == credstore.ErrNotFound {
+		return "", nil, errNoRefreshToken
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to read the refresh token from %v: %v", store, err)
+	}
+	return token, store, nil
+}
+
+// exchangeRefreshToken exchanges the refresh token for an access token. Ring hands out
+// a new refresh token with every exchange, it replaces the stored one.
+func exchangeRefreshToken(refreshToken string, store credstore.Store) (string, error) {
+	accessToken, newRefreshToken, err := bridge.AccessToken(refreshToken)
+	if err == bridge.ErrAccessDenied {
+		return "", errors.New("Ring refused the refresh token, get a new one with getRefreshKey")
+	}
+	if err != nil {
+		return "", err
+	}
+	if store != nil && newRefreshToken != "" && newRefreshToken != refreshToken {
+		if err := storeRotated(store, newRefreshToken); err != nil {
+			log.Printf("Unable to store the new refresh token in %v - %v", store, err)
+		}
+	}
+	return accessToken, nil
+}
+
+// storeRotated writes the refresh token Ring handed out to the store. A
+// replayed cassette only holds recorder.Redacted tokens, they never replace
+// the stored one.
+func storeRotated(store credstore.Store, refreshToken string) error {
+	if replayFile != "" || refreshToken == recorder.Redacted {
+		log.Printf("Not storing the refresh token of the replayed cassette in %v", store)
+		return nil
+	}
+	err := store.Set(profile.Name, refreshToken)
+	auditCLI("token-rotate", err, store.String())
+	return err
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/asishrs/smartthings-ringalarmv2/credstore"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/recorder"
+)
+
+// memoryStore is a credstore.Store holding the tokens in memory.
+type memoryStore map[string]string
+
+func (s memoryStore) Get(profile string) (string, error) {
+	token, ok := s[profile]
+	if !ok {
+		return "", credstore.ErrNotFound
+	}
+	return token, nil
+}
+func (s memoryStore) Set(profile, token string) error { s[profile] = token; return nil }
+func (s memoryStore) Delete(profile string) error     { delete(s, profile); return nil }
+func (s memoryStore) String() string                  { return "memory" }
+
+// ringAnswers makes the OAuth endpoint hand out the tokens, as a cassette would.
+func ringAnswers(accessToken, refreshToken string) {
+	httputil.Client.Transport = recorder.NewReplayer(&recorder.Cassette{HTTP: []recorder.HTTPInteraction{{
+		Request: recorder.HTTPRequest{Method: "POST", URL: "https://oauth.ring.com/oauth/token"},
+		Response: recorder.HTTPResponse{
+			StatusCode: 200,
+			Body:       `{"access_token":"` + accessToken + `","refresh_token":"` + refreshToken + `"}`,
+		},
+	}}})
+}
+
+func TestExchangeRefreshTokenRotation(t *testing.T) {
+	transport := httputil.Client.Transport
+	defer func() { httputil.Client.Transport = transport }()
+
+	tests := []struct {
+		name       string
+		replay     string
+		newToken   string
+		wantStored string
+	}{
+		{name: "new token is stored", newToken: "rotated", wantStored: "rotated"},
+		{name: "same token", newToken: "stored", wantStored: "stored"},
+		{name: "no new token", newToken: "", wantStored: "stored"},
+		{name: "replayed cassette", replay: "cassette.json", newToken: recorder.Redacted, wantStored: "stored"},
+		{name: "replayed cassette with a token", replay: "cassette.json", newToken: "rotated", wantStored: "stored"},
+		{name: "redacted token without replay", newToken: recorder.Redacted, wantStored: "stored"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replayFile = test.replay
+			defer func() { replayFile = "" }()
+			ringAnswers("access", test.newToken)
+			store := memoryStore{profile.Name: "stored"}
+
+			accessToken, err := exchangeRefreshToken("stored", store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accessToken != "access" {
+				t.Errorf("exchangeRefreshToken() = %q, want %q", accessToken, "access")
+			}
+			if got := store[profile.Name]; got != test.wantStored {
+				t.Errorf("stored token = %q, want %q", got, test.wantStored)
+			}
+		})
+	}
+}
+
+func TestTokenSourceReplay(t *testing.T) {
+	transport := httputil.Client.Transport
+	defer func() { httputil.Client.Transport = transport }()
+	replayFile = "cassette.json"
+	defer func() { replayFile = "" }()
+	ringAnswers(recorder.Redacted, recorder.Redacted)
+
+	store := memoryStore{profile.Name: "stored"}
+	if _, err := newTokenSource("stored", store).AccessToken(); err != nil {
+		t.Fatal(err)
+	}
+	if got := store[profile.Name]; got != "stored" {
+		t.Errorf("stored token = %q, want %q", got, "stored")
+	}
+}
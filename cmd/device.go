@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/spf13/cobra"
+)
+
+// deviceCmd represents the device command
+var deviceCmd = &cobra.Command{
+	Use:   "device <zid or name> <command>",
+	Short: "Switch, dim, lock or unlock a Z-Wave device of the base station",
+	Long: `Sends a command to a Z-Wave device paired with the Ring Alarm base station:
+
+  switch.on, switch.off   a switch or dimmer
+  dimmer.level            a dimmer, to --level from 0 to 100
+  lock.lock, lock.unlock  a lock
+
+The command is checked against the type of the device, and a lock must list 
+it in its commandTypes. The devices command shows the ZIDs and names.
+
+  ./main device "Porch Light" dimmer.level --level 40`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var level *int
+		if cmd.Flags().Changed("level") {
+			value, _ := cmd.Flags().GetInt("level")
+			level = &value
+		}
+		account, err := login(cmd)
+		if err != nil {
+			return err
+		}
+		device, err := bridge.SendDeviceCommand(account.locationID, account.accessToken, args[0], args[1], level)
+		auditCLI("device-command", err, strings.TrimSpace(device.ZID+" "+args[1]))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sent %v to %v (%v)\n", args[1], device.Name, device.Type)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deviceCmd)
+
+	addRingFlags(deviceCmd)
+	deviceCmd.Flags().Int("level", 0, "Level of dimmer.level, from 0 to 100")
+}
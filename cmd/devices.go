@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/spf13/cobra"
+)
+
+// deviceRecord is the readable form of a Ring device. The device list only
+// holds the id of the room, Ring sends the room names separately.
+type deviceRecord struct {
+	Name          string `json:"name" yaml:"name"`
+	Type          string `json:"type" yaml:"type"`
+	ZID           string `json:"zid" yaml:"zid"`
+	RoomID        int    `json:"roomId" yaml:"roomId"`
+	BatteryLevel  int    `json:"batteryLevel" yaml:"batteryLevel"`
+	BatteryStatus string `json:"batteryStatus" yaml:"batteryStatus"`
+	TamperStatus  string `json:"tamperStatus" yaml:"tamperStatus"`
+	CommStatus    string `json:"commStatus" yaml:"commStatus"`
+	Faulted       bool   `json:"faulted" yaml:"faulted"`
+}
+
+// devicesCmd represents the devices command
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "List the Ring Alarm devices",
+	Long: `Lists every device of the Ring Alarm with its type, ZID, room id, battery, 
+tamper, communication and faulted status.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output := flagOrProfile(cmd, "output", profile.Output)
+		deviceType := cmd.Flag("type").Value.String()
+		room, _ := cmd.Flags().GetInt("room")
+		return listDevices(cmd, output, deviceType, room)
+	},
+}
+
+func listDevices(cmd *cobra.Command, output, deviceType string, room int) error {
+	account, err := login(cmd)
+	if err != nil {
+		return err
+	}
+	devices, err := bridge.Devices(account.locationID, account.accessToken)
+	if err != nil {
+		return err
+	}
+
+	records := []deviceRecord{}
+	for i := range devices.Body {
+		record := newDeviceRecord(devices.Body[i])
+		if deviceType != "" && !strings.EqualFold(record.Type, deviceType) {
+			continue
+		}
+		if room >= 0 && record.RoomID != room {
+			continue
+		}
+		records = append(records, record)
+	}
+
+	headers := []string{"name", "type", "zid", "room id", "battery", "tamper", "comm", "faulted"}
+	var rows [][]string
+	for _, record := range records {
+		battery := record.BatteryStatus
+		if record.BatteryLevel > 0 {
+			battery = strconv.Itoa(record.BatteryLevel) + "% " + battery
+		}
+		rows = append(rows, []string{record.Name, record.Type, record.ZID, strconv.Itoa(record.RoomID), strings.TrimSpace(battery), record.TamperStatus, record.CommStatus, strconv.FormatBool(record.Faulted)})
+	}
+	return writeOutput(output, records, headers, rows)
+}
+
+func newDeviceRecord(body httputil.Body) deviceRecord {
+	general := body.General.V2
+	return deviceRecord{
+		Name:          general.Name,
+		Type:          general.DeviceType,
+		ZID:           general.ZID,
+		RoomID:        general.RoomID,
+		BatteryLevel:  general.BatteryLevel,
+		BatteryStatus: general.BatteryStatus,
+		TamperStatus:  general.TamperStatus,
+		CommStatus:    general.CommStatus,
+		Faulted:       body.Device.V1.Faulted,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+
+	addRingFlags(devicesCmd)
+	devicesCmd.Flags().StringP("output", "o", "table", "Output format (table, json, yaml or csv, default is the output of the config profile)")
+	devicesCmd.Flags().StringP("type", "t", "", "Only list devices of this type, e.g. sensor.contact")
+	devicesCmd.Flags().Int("room", -1, "Only list devices in the room with this id")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/asishrs/smartthings-ringalarmv2/disarm"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// disarmPolicyCmd represents the disarmPolicy command
+var disarmPolicyCmd = &cobra.Command{
+	Use:   "disarmPolicy",
+	Short: "Manage the PIN or TOTP code the bridge needs to disarm",
+	Long: `Sets the PIN or the authenticator app (TOTP) secret the bridge checks before it 
+disarms. Requests to off must then send "disarmCode" in the body. Arming never 
+needs the code. After --maxAttempts wrong codes in a row disarming is locked for 
+--lockout minutes.
+
+The policy is kept in a secrets backend, the RING_DISARM_POLICY of the Lambda 
+(ssm:<parameter name> or secretsmanager:<secret id>) or the server.disarmPolicy 
+of serve (file:<path>). --policy defaults to server.disarmPolicy of the config 
+profile.`,
+}
+
+var disarmPolicyPINCmd = &cobra.Command{
+	Use:          "pin",
+	Short:        "Set the disarm PIN",
+	Long:         `Asks for the PIN and stores its bcrypt hash.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateDisarmPolicy(cmd, func(policy *disarm.Policy) error {
+			pin, err := readPIN()
+			if err != nil {
+				return err
+			}
+			return policy.SetPIN(pin)
+		})
+	},
+}
+
+var disarmPolicyTOTPCmd = &cobra.Command{
+	Use:          "totp",
+	Short:        "Create a new authenticator app (TOTP) secret",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateDisarmPolicy(cmd, func(policy *disarm.Policy) error {
+			secret, err := disarm.NewTOTPSecret()
+			if err != nil {
+				return err
+			}
+			policy.TOTPSecret = secret
+			fmt.Printf("Add this to your authenticator app (as a QR code or by hand):\n%v\n\nSecret - %v\n\n", disarm.TOTPURL(secret, profile.Name), secret)
+			return nil
+		})
+	},
+}
+
+var disarmPolicyClearCmd = &cobra.Command{
+	Use:          "clear",
+	Short:        "Remove the PIN and TOTP secret, disarming needs no code",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateDisarmPolicy(cmd, func(policy *disarm.Policy) error {
+			*policy = disarm.Policy{}
+			return nil
+		})
+	},
+}
+
+var disarmPolicyShowCmd = &cobra.Command{
+	Use:          "show",
+	Short:        "Show what the disarm policy needs",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, policy, err := disarmPolicy(cmd)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Policy:       %v\n", backend)
+		fmt.Printf("PIN:          %v\n", policy.PINHash != "")
+		fmt.Printf("TOTP:         %v\n", policy.TOTPSecret != "")
+		if policy.Enabled() {
+			maxAttempts, lockout := policy.MaxAttempts, policy.LockoutMinutes
+			if maxAttempts == 0 {
+				maxAttempts = disarm.DefaultMaxAttempts
+			}
+			if lockout == 0 {
+				lockout = disarm.DefaultLockoutMinutes
+			}
+			fmt.Printf("Lockout:      %v minutes after %v wrong codes\n", lockout, maxAttempts)
+		}
+		return nil
+	},
+}
+
+// updateDisarmPolicy applies the change and the lockout flags to the policy and stores it.
+func updateDisarmPolicy(cmd *cobra.Command, change func(*disarm.Policy) error) error {
+	backend, policy, err := disarmPolicy(cmd)
+	if err != nil {
+		return err
+	}
+	if err := change(&policy); err != nil {
+		return err
+	}
+	if flag := cmd.Flag("maxAttempts"); flag != nil && flag.Changed {
+		policy.MaxAttempts, _ = cmd.Flags().GetInt("maxAttempts")
+	}
+	if flag := cmd.Flag("lockout"); flag != nil && flag.Changed {
+		policy.LockoutMinutes, _ = cmd.Flags().GetInt("lockout")
+	}
+	err = disarm.SavePolicy(backend, policy)
+	auditCLI("disarm-policy-"+cmd.Name(), err, backend.String())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated the disarm policy in %v.\n", backend)
+	return nil
+}
+
+// disarmPolicy reads the policy of the --policy backend. A missing file is an empty policy.
+func disarmPolicy(cmd *cobra.Command) (secrets.Backend, disarm.Policy, error) {
+	spec := flagOrProfile(cmd, "policy", profile.Server.DisarmPolicy)
+	if spec == "" {
+		return nil, disarm.Policy{}, errors.New("no disarm policy backend, use --policy or set server.disarmPolicy in the config profile")
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return nil, disarm.Policy{}, err
+	}
+	policy, err := disarm.LoadPolicy(backend)
+	if _, isFile := backend.(secrets.File); isFile && os.IsNotExist(err) {
+		return backend, disarm.Policy{}, nil
+	}
+	return backend, policy, err
+}
+
+// readPIN asks for the PIN twice on the terminal, or reads one line from stdin.
+func readPIN() (string, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+	fmt.Fprint(os.Stderr, "Disarm PIN: ")
+	pin, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat the PIN: ")
+	repeat, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(pin) != string(repeat) {
+		return "", errors.New("the PINs do not match")
+	}
+	return string(pin), nil
+}
+
+func init() {
+	rootCmd.AddCommand(disarmPolicyCmd)
+	disarmPolicyCmd.AddCommand(disarmPolicyPINCmd)
+	disarmPolicyCmd.AddCommand(disarmPolicyTOTPCmd)
+	disarmPolicyCmd.AddCommand(disarmPolicyClearCmd)
+	disarmPolicyCmd.AddCommand(disarmPolicyShowCmd)
+
+	disarmPolicyCmd.PersistentFlags().String("policy", "", "Secrets backend of the disarm policy (default is server.disarmPolicy of the config profile)")
+	for _, command := range []*cobra.Command{disarmPolicyPINCmd, disarmPolicyTOTPCmd} {
+		command.Flags().Int("maxAttempts", disarm.DefaultMaxAttempts, "Wrong codes in a row before disarming is locked")
+		command.Flags().Int("lockout", disarm.DefaultLockoutMinutes, "Minutes disarming stays locked")
+	}
+}
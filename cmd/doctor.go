@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/asishrs/smartthings-ringalarmv2/signature"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
+	"github.com/spf13/cobra"
+)
+
+// errSkipped marks a check that could not run because an earlier one failed.
+var errSkipped = errors.New("skipped")
+
+// doctorCheck is one step of the setup and the hint to fix it.
+type doctorCheck struct {
+	name string
+	hint string
+	run  func() error
+	// independent checks still run after an earlier check failed.
+	independent bool
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check every step of the Ring Alarm setup",
+	Long: `Runs each step the bridge needs in turn and prints whether it passed, with a 
+hint on how to fix it when it did not:
+
+  - the refresh token can be exchanged for an access token
+  - the Ring location resolves
+  - Ring returns a websocket server for the location
+  - the websocket connects and returns the device list
+  - the security panel (access-code adapter) ZID is found
+  - the API Gateway endpoint answers with the API key (with --endpoint)
+
+The endpoint is checked even when a Ring step failed. It is called with the
+--bridgeKey and signed with the --signingKey when the bridge requires them.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDoctor(cmd)
+	},
+}
+
+func runDoctor(cmd *cobra.Command) error {
+	endpoint := strings.TrimRight(flagOrProfile(cmd, "endpoint", profile.Endpoint), "/")
+	apiKey := flagOrProfile(cmd, "apiKey", profile.APIKey)
+	bridgeKey := flagOrProfile(cmd, "bridgeKey", profile.BridgeKey)
+	var signingKey *signature.Key
+	if value := flagOrProfile(cmd, "signingKey", profile.SigningKey); value != "" {
+		key, err := signature.ParseKey(value)
+		if err != nil {
+			return fmt.Errorf("signingKey: %v", err)
+		}
+		signingKey = &key
+	}
+
+	var (
+		accessToken string
+		location    httputil.UserLocation
+		connection  httputil.RingWSConnection
+		devices     *httputil.RingDeviceInfo
+	)
+	checks := []doctorCheck{
+		{
+			name: "Refresh token can be exchanged for an access token",
+			hint: "Log in again with get2faCode and getRefreshKey, or pass a refresh token with --refreshToken or the config profile.",
+			run: func() error {
+				refreshToken, store, err := resolveRefreshToken(cmd)
+				if err != nil {
+					return err
+				}
+				accessToken, err = exchangeRefreshToken(refreshToken, store)
+				return err
+			},
+		},
+		{
+			name: "Ring location resolves",
+			hint: "Make sure the Ring account has a location with a Ring Alarm in the Ring app.",
+			run: func() error {
+				var err error
+				location, err = httputil.LocationRequest("https://api.ring.com/devices/v1/locations", accessToken)
+				return err
+			},
+		},
+		{
+			name: "rs/connections returns a websocket server",
+			hint: "The location has no Ring Alarm base station, or Ring is down. Check https://status.ring.com.",
+			run: func() error {
+				var err error
+				connection, err = httputil.ConnectionRequest("https://app.ring.com/api/v1/rs/connections", location.ID, accessToken)
+				if err == nil && (connection.Server == "" || connection.AuthCode == "") {
+					err = errors.New("no server in the response")
+				}
+				return err
+			},
+		},
+		{
+			name: "Websocket connects and answers DeviceInfoDocGetList",
+			hint: "Outbound websocket (wss, port 443) connections may be blocked. Set RING_HTTP_PROXY if you are behind a proxy.",
+			run: func() error {
+				session, err := wsutil.Open(connection)
+				if err != nil {
+					return err
+				}
+				defer session.Close()
+				devices, err = session.DeviceList()
+				if err == nil && len(devices.Body) == 0 {
+					err = errors.New("no devices returned")
+				}
+				return err
+			},
+		},
+		{
+			name: "Security panel (access-code adapter) ZID exists",
+			hint: "The base station may still be setting up. Finish the setup in the Ring app, or pass the ZID with --zid.",
+			run: func() error {
+				for i := range devices.Body {
+					if devices.Body[i].General.V2.DeviceType == "access-code" && devices.Body[i].General.V2.AdapterZID != "" {
+						return nil
+					}
+				}
+				return errors.New("no access-code device found")
+			},
+		},
+		{
+			name: "API Gateway endpoint answers with the API key",
+			hint: "Use the Invoke URL and API Key from the API Gateway console (see the README), e.g. --endpoint https://xxxx.execute-api.us-east-1.amazonaws.com/v1 --apiKey <key>, and --bridgeKey and --signingKey when the bridge requires them.",
+			run: func() error {
+				if endpoint == "" {
+					return errSkipped
+				}
+				return checkEndpoint(endpoint, apiKey, bridgeKey, signingKey, accessToken)
+			},
+			independent: true,
+		},
+	}
+
+	failed := false
+	for _, check := range checks {
+		var err error
+		if failed && !check.independent {
+			err = errSkipped
+		} else {
+			err = check.run()
+		}
+		switch {
+		case err == errSkipped:
+			fmt.Printf("[SKIP] %v\n", check.name)
+		case err != nil:
+			failed = true
+			fmt.Printf("[FAIL] %v\n       %v\n       Fix: %v\n", check.name, err, check.hint)
+		default:
+			fmt.Printf("[PASS] %v\n", check.name)
+		}
+	}
+	if failed {
+		return errors.New("setup has problems, see the checks above")
+	}
+	return nil
+}
+
+// checkEndpoint calls the meta action of the deployed bridge. Without an
+// access token only the keys and the signature can be checked, any answer
+// past them passes.
+func checkEndpoint(endpoint, apiKey, bridgeKey string, signingKey *signature.Key, accessToken string) error {
+	body, _ := json.Marshal(public.Request{AccessToken: accessToken})
+	req, err := http.NewRequest("POST", endpoint+"/meta", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("x-api-key", apiKey)
+	}
+	if bridgeKey != "" {
+		req.Header.Set("Authorization", "Bearer "+bridgeKey)
+	}
+	if signingKey != nil {
+		headers, err := signature.Headers(*signingKey, signature.Request{Method: req.Method, Path: "/meta", Body: body})
+		if err != nil {
+			return err
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+	}
+	res, err := httputil.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	responseBody, _ := ioutil.ReadAll(res.Body)
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		return errors.New("401 Unauthorized, the bridge key or the request signature is missing or wrong")
+	case res.StatusCode == http.StatusForbidden:
+		return errors.New("403 Forbidden, the API key is missing or wrong, or the bridge key does not have the devices:read scope")
+	case accessToken == "":
+		return nil
+	case res.StatusCode != http.StatusOK:
+		return fmt.Errorf("%v %v", res.Status, strings.TrimSpace(string(responseBody)))
+	}
+	var meta public.RingMetaDataResponse
+	if err := json.Unmarshal(responseBody, &meta); err != nil || meta.Location.ID == "" {
+		return fmt.Errorf("unexpected response %v", strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringP("refreshToken", "r", "", "Ring Refresh Token (default is the refreshToken of the config profile or the stored one)")
+	doctorCmd.Flags().String("endpoint", "", "API Gateway Invoke URL of the deployed bridge (default is the endpoint of the config profile)")
+	doctorCmd.Flags().String("apiKey", "", "API Gateway API Key of the deployed bridge (default is the apiKey of the config profile)")
+	doctorCmd.Flags().String("bridgeKey", "", "Scoped API key of the deployed bridge (default is the bridgeKey of the config profile)")
+	doctorCmd.Flags().String("signingKey", "", "Key to sign the request with, as <name>:<secret> (default is the signingKey of the config profile)")
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/asishrs/smartthings-ringalarmv2/httputil"
 	"github.com/spf13/cobra"
@@ -23,8 +22,8 @@ Check https://support.ring.com/hc/en-us/articles/360024818291 if you need more d
 }
 
 func makeAuthRequest(user, password string) {
-	response, err := httputil.AuthRequest("https://oauth.ring.com/oauth/token", httputil.OAuthRequest{"ring_official_ios", "password", password, "client", user}, "")
-	log.Printf("OAuthResponse - %v", response)
+	response, err := httputil.AuthRequest("https://oauth.ring.com/oauth/token", httputil.OAuthRequest{ClientID: "ring_official_ios", GrantType: "password", Password: password, Scope: "client", Username: user}, "")
+	httputil.Trace.Printf("OAuthResponse - %v", response)
 	if err != nil {
 		fmt.Println("Unable to authenticate. Please check your user name and password")
 	} else if response.Error != "" {
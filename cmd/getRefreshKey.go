@@ -13,27 +13,49 @@ var getRefreshKeyCmd = &cobra.Command{
 	Short: "Get Ring Alarm Refresh Key",
 	Long: `With 2FA enabled Ring requires us to use a special refresh key that can be used 
 long-term with 2FA turned on. A refresh key does not expire and allows us to 
-bypass email/password/2FA altogether.`,
+bypass email/password/2FA altogether.
+
+The refresh token is stored encrypted in the credential store of the config 
+profile (the OS keyring or an encrypted file), where the other commands read it 
+from. Use --print to print it instead.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		user := cmd.Flag("user")
 		password := cmd.Flag("password")
 		code := cmd.Flag("2facode")
-		getRefreshToken(user.Value.String(), password.Value.String(), code.Value.String())
+		printOnly, _ := cmd.Flags().GetBool("print")
+		getRefreshToken(user.Value.String(), password.Value.String(), code.Value.String(), printOnly)
 	},
 }
 
-func getRefreshToken(user string, password string, code string) {
-	response, err := httputil.AuthRequest("https://oauth.ring.com/oauth/token", httputil.OAuthRequest{"ring_official_ios", "password", password, "client", user}, code)
+func getRefreshToken(user string, password string, code string, printOnly bool) {
+	response, err := httputil.AuthRequest("https://oauth.ring.com/oauth/token", httputil.OAuthRequest{ClientID: "ring_official_ios", GrantType: "password", Password: password, Scope: "client", Username: user}, code)
 	if err != nil {
 		fmt.Println("Unable to authenticate. Please check your user name, password and 2FA code")
 	} else if response.Error != "" {
 		fmt.Printf("Unable to authenticate. \nRing API Error - %v\n", response.Error)
+	} else if response.RefreshToken != "" && !printOnly {
+		storeRefreshToken(response.RefreshToken)
 	} else if response.RefreshToken != "" {
 		fmt.Printf("Your Refresh Token - \n%v\n\n", response.RefreshToken)
 		fmt.Println("*** WARNING *** \n Refresh Token is equally powerful as your user-name/password as it can be used to access your account. DO NOT share this with anyone.\nNote Refresh Token, you will be asked to input this in the RingAlarm Smartthings App.")
 	}
 }
 
+// storeRefreshToken saves the token in the credential store of the config profile.
+func storeRefreshToken(token string) {
+	store, err := credentialStore()
+	if err == nil {
+		err = store.Set(profile.Name, token)
+		auditCLI("token-store", err, store.String())
+	}
+	if err != nil {
+		fmt.Printf("Unable to store the Refresh Token - %v\nRun again with --print to print it instead.\n", err)
+		return
+	}
+	fmt.Printf("Refresh Token stored for profile %v in %v.\n", profile.Name, store)
+	fmt.Println("Use `token show --reveal` when you need to input it in the RingAlarm Smartthings App.")
+}
+
 func init() {
 	rootCmd.AddCommand(getRefreshKeyCmd)
 
@@ -48,4 +70,5 @@ func init() {
 	getRefreshKeyCmd.Flags().StringP("user", "u", "", "Ring Account User Name (Email Address)")
 	getRefreshKeyCmd.Flags().StringP("password", "p", "", "Ring Account Password")
 	getRefreshKeyCmd.Flags().StringP("2facode", "c", "", "Ring Two Factor Authentication (2FA) Code (Received from Text message)")
+	getRefreshKeyCmd.Flags().Bool("print", false, "Print the Refresh Token instead of storing it")
 }
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/spf13/cobra"
+)
+
+// historyRecord is one history event in the export.
+type historyRecord struct {
+	Time    string           `json:"time"`
+	Type    string           `json:"type"`
+	Context httputil.Context `json:"context"`
+}
+
+var historyHeaders = []string{
+	"time", "type", "eventId", "eventOccurredTsMs",
+	"affectedEntityType", "affectedEntityId", "affectedEntityName",
+	"initiatingEntityType", "initiatingEntityId", "initiatingEntityName",
+	"interfaceType", "interfaceId", "interfaceName",
+	"affectedParentId", "affectedParentName",
+	"accountId", "programId", "userAgent", "ipAddress", "assetId", "assetKind",
+}
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Export the Ring Alarm history to CSV or NDJSON",
+	Long: `Pages through the Ring Alarm history between two dates and writes every event 
+with the affected device, the initiating user and the interface used.
+
+Dates are YYYY-MM-DD or RFC 3339 times and are read in the --timezone.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return exportHistory(cmd)
+	},
+}
+
+func exportHistory(cmd *cobra.Command) error {
+	location, err := time.LoadLocation(cmd.Flag("timezone").Value.String())
+	if err != nil {
+		return err
+	}
+	now := time.Now().In(location)
+	from, err := parseHistoryDate(cmd.Flag("from").Value.String(), location, now.AddDate(0, 0, -7), false)
+	if err != nil {
+		return err
+	}
+	to, err := parseHistoryDate(cmd.Flag("to").Value.String(), location, now, true)
+	if err != nil {
+		return err
+	}
+	if !to.After(from) {
+		return fmt.Errorf("--to %v is not after --from %v", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	output := cmd.Flag("output").Value.String()
+	if output != "csv" && output != "ndjson" {
+		return fmt.Errorf("invalid output %q, use csv or ndjson", output)
+	}
+
+	account, err := login(cmd)
+	if err != nil {
+		return err
+	}
+	// The file is only created once the login worked, so a refused token does not truncate it.
+	var write func(record historyRecord) error
+	var flush func() error
+	out, closeOut, err := historyOutput(cmd.Flag("file").Value.String())
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+	if output == "csv" {
+		w := csv.NewWriter(out)
+		w.Write(historyHeaders)
+		write = func(record historyRecord) error { return w.Write(historyRow(record)) }
+		flush = func() error { w.Flush(); return w.Error() }
+	} else {
+		encoder := json.NewEncoder(out)
+		write = func(record historyRecord) error { return encoder.Encode(record) }
+		flush = func() error { return nil }
+	}
+
+	err = bridge.History(account.locationID, account.accessToken, from, to, func(event httputil.History) error {
+		return write(historyRecord{
+			Time:    bridge.EventTime(event).In(location).Format(time.RFC3339),
+			Type:    bridge.EventType(event),
+			Context: event.Context,
+		})
+	})
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// parseHistoryDate reads a YYYY-MM-DD date or an RFC 3339 time. An empty value
+// returns the default. A date is the start of the day, or its end with endOfDay.
+func parseHistoryDate(value string, location *time.Location, defaultValue time.Time, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, location); err == nil {
+		if endOfDay {
+			return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+func historyOutput(file string) (io.Writer, func(), error) {
+	if file == "" || file == "-" {
+		return os.Stdout, func() {}, nil
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+func historyRow(record historyRecord) []string {
+	c := record.Context
+	return []string{
+		record.Time, record.Type, c.EventID, strconv.FormatInt(c.EventOccurredTsMs, 10),
+		c.AffectedEntityType, c.AffectedEntityID, c.AffectedEntityName,
+		c.InitiatingEntityType, c.InitiatingEntityID, c.InitiatingEntityName,
+		c.InterfaceType, c.InterfaceID, c.InterfaceName,
+		c.AffectedParentID, c.AffectedParentName,
+		c.AccountID, c.ProgramID, c.UserAgent, c.IPAddress, c.AssetID, c.AssetKind,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	addRingFlags(historyCmd)
+	historyCmd.Flags().String("from", "", "Export events from this date (default is 7 days ago)")
+	historyCmd.Flags().String("to", "", "Export events up to this date, a date includes the whole day (default is now)")
+	historyCmd.Flags().String("timezone", "Local", "Timezone of the dates and the exported times, e.g. America/New_York")
+	historyCmd.Flags().StringP("output", "o", "csv", "Output format (csv or ndjson)")
+	historyCmd.Flags().StringP("file", "f", "", "File to write (default is stdout)")
+}
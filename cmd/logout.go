@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/asishrs/smartthings-ringalarmv2/credstore"
+	"github.com/spf13/cobra"
+)
+
+// logoutCmd represents the logout command
+var logoutCmd = &cobra.Command{
+	Use:          "logout",
+	Short:        "Remove the stored Ring Refresh Token",
+	SilenceUsage: true,
+	Long: `Removes the refresh token of the config profile from the credential store. 
+Run getRefreshKey to log in again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := credentialStore()
+		if err != nil {
+			return err
+		}
+		err = store.Delete(profile.Name)
+		auditCLI("token-delete", err, store.String())
+		if err == credstore.ErrNotFound {
+			fmt.Printf("No Refresh Token stored for profile %v.\n", profile.Name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed the Refresh Token of profile %v from %v.\n", profile.Name, store)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+}
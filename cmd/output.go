@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// outputFormats are the values accepted by --output.
+var outputFormats = []string{"table", "json", "yaml", "csv"}
+
+// writeOutput prints the records in the format. Table and csv use the
+// headers and rows, json and yaml encode the records themselves.
+func writeOutput(format string, records interface{}, headers []string, rows [][]string) error {
+	switch format {
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(headers, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(headers)
+		w.WriteAll(rows)
+		return w.Error()
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "yaml":
+		data, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return fmt.Errorf("invalid output %q, use one of %v", format, strings.Join(outputFormats, ", "))
+	}
+}
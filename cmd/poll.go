@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/asishrs/smartthings-ringalarmv2/poller"
+	"github.com/spf13/cobra"
+)
+
+// pollCmd represents the poll command
+var pollCmd = &cobra.Command{
+	Use:   "poll",
+	Short: "Send the Ring Alarm changes since the previous run",
+	Long: `Reads the devices and the history once, compares them with the previous run 
+and sends the device changes and new history events to the sinks. Run it from 
+cron where a websocket connection can not be kept open. The first run only 
+records the state.
+
+Sinks, comma separated:
+
+  log          one CHANGES JSON line per run on stderr
+  file:<path>  one JSON line per run appended to the file
+  webhooks     the device changes are posted to the webhooks (see webhook)
+  sns:<arn>    one message per run published to the SNS topic
+
+The state is kept in --store: file:<dir> (the default is poller under the 
+config directory), dynamodb:<table> or memory.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := poller.NewStore(flagOrProfile(cmd, "store", profile.Poller.Store))
+		if err != nil {
+			return err
+		}
+		dispatcher, err := newDispatcher()
+		if err != nil {
+			return err
+		}
+		sinks, err := poller.NewSinks(flagOrProfile(cmd, "sink", profile.Poller.Sinks), dispatcher)
+		if err != nil {
+			return err
+		}
+		account, err := login(cmd)
+		if err != nil {
+			return err
+		}
+		changes, err := (&poller.Poller{Store: store, Sinks: sinks}).Run(account.locationID, account.accessToken)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d device changes and %d history events since the previous run\n", len(changes.Devices), len(changes.History))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pollCmd)
+
+	addRingFlags(pollCmd)
+	pollCmd.Flags().String("store", "", "Where the state between runs is kept (default is poller.store of the config profile)")
+	pollCmd.Flags().String("sink", "", "Where the changes are sent, comma separated (default is poller.sinks of the config profile, or log)")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/recorder"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
+	"github.com/spf13/cobra"
+)
+
+// recordCmd represents the record command
+var recordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Record the Ring API traffic to a redacted cassette file",
+	Long: `Runs the same calls the bridge makes (authentication, location, history, 
+websocket connection and device list) against your Ring account and writes every 
+HTTP exchange and websocket frame to a cassette file. Tokens, account ids and 
+personal details are redacted, so the cassette can be attached to a bug report.
+A cassette can be played back with the --replay flag.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		refreshToken := cmd.Flag("refreshToken")
+		output := cmd.Flag("output")
+		limit := cmd.Flag("historyLimit")
+		recordSession(refreshToken.Value.String(), limit.Value.String(), output.Value.String())
+	},
+}
+
+func recordSession(refreshToken, limit, output string) {
+	rec := recorder.NewRecorder()
+	rec.Install()
+
+	err := runSession(refreshToken, limit)
+	if saveErr := rec.Save(output); saveErr != nil {
+		fmt.Printf("Unable to save the cassette - %v\n", saveErr)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Recording stopped early - %v\n", err)
+	}
+	fmt.Printf("Ring API traffic recorded to %v\n", output)
+}
+
+func runSession(refreshToken, limit string) error {
+	oauthResponse, err := httputil.AuthRequestWithRefreshToken("https://oauth.ring.com/oauth/token", httputil.OAuthRequestWithRefreshToken{ClientID: "ring_official_ios", GrantType: "refresh_token", RefreshToken: refreshToken})
+	if err != nil {
+		return err
+	}
+	if oauthResponse.Error != "" {
+		return fmt.Errorf("Ring API Error - %v", oauthResponse.Error)
+	}
+
+	location, err := httputil.LocationRequest("https://api.ring.com/devices/v1/locations", oauthResponse.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	if _, err := httputil.HistoryRequest("https://app.ring.com/api/v1/rs/history", oauthResponse.AccessToken, location.ID, limit); err != nil {
+		return err
+	}
+
+	connection, err := httputil.ConnectionRequest("https://app.ring.com/api/v1/rs/connections", location.ID, oauthResponse.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = wsutil.ActiveDevices(connection)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(recordCmd)
+
+	recordCmd.Flags().StringP("refreshToken", "r", "", "Ring Refresh Token (see getRefreshKey)")
+	recordCmd.Flags().StringP("output", "o", "ring-cassette.json", "Cassette file to write")
+	recordCmd.Flags().IntP("historyLimit", "l", 10, "Number of history events to record")
+}
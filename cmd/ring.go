@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/spf13/cobra"
+)
+
+// ringAccount is the Ring account and location a command works on.
+type ringAccount struct {
+	accessToken string
+	locationID  string
+	zID         string
+}
+
+// addRingFlags adds the flags selecting the Ring account to the command.
+func addRingFlags(command *cobra.Command) {
+	command.Flags().StringP("refreshToken", "r", "", "Ring Refresh Token (default is the refreshToken of the config profile or the stored one)")
+	command.Flags().String("location", "", "Ring Location ID (default is the config profile location or the first location of the account)")
+	command.Flags().String("zid", "", "Ring Security Panel ZID (default is the config profile zid or looked up from the devices)")
+}
+
+// flagOrProfile returns the flag value when it was given, otherwise the value from the config profile.
+func flagOrProfile(command *cobra.Command, name string, profileValue string) string {
+	if flag := command.Flag(name); flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	return profileValue
+}
+
+// login authenticates with the refresh token of the command, the config profile
+// or the credential store and finds the location.
+func login(command *cobra.Command) (ringAccount, error) {
+	refreshToken, store, err := resolveRefreshToken(command)
+	if err != nil {
+		return ringAccount{}, err
+	}
+	accessToken, err := exchangeRefreshToken(refreshToken, store)
+	if err != nil {
+		return ringAccount{}, err
+	}
+
+	account := ringAccount{
+		accessToken: accessToken,
+		locationID:  flagOrProfile(command, "location", profile.Location),
+		zID:         flagOrProfile(command, "zid", profile.ZID),
+	}
+	if account.locationID == "" {
+		location, err := bridge.Location(accessToken)
+		if err != nil {
+			return ringAccount{}, err
+		}
+		account.locationID = location.ID
+	}
+	return account, nil
+}
@@ -2,14 +2,27 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/spf13/cobra"
+	"io/ioutil"
 	"os"
+	"os/user"
+	"strings"
 
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	"github.com/asishrs/smartthings-ringalarmv2/config"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/recorder"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
 	homedir "github.com/mitchellh/go-homedir"
-	"github.com/spf13/viper"
+	"github.com/spf13/cobra"
 )
 
 var cfgFile string
+var profileName string
+var replayFile string
+var verbose bool
+
+// profile is the configuration profile selected for the command.
+var profile config.Profile
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -20,6 +33,24 @@ For more details check https://github.com/asishrs/smartthings-ringalarmv2`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if !verbose {
+			// Only the trace of the Ring calls is hidden, warnings and the
+			// audit log still go to stderr.
+			httputil.Trace.SetOutput(ioutil.Discard)
+		}
+		if err := initConfig(); err != nil {
+			return err
+		}
+		if err := configureClients(); err != nil {
+			return err
+		}
+		if replayFile != "" {
+			return replay(replayFile)
+		}
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -32,41 +63,68 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cobra-cmd.yaml)")
-
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ~/.config/ring-bridge/config.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "P", "", "config profile (default is $RING_BRIDGE_PROFILE or the defaultProfile of the config file)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "log the calls made to Ring")
+	rootCmd.PersistentFlags().StringVar(&replayFile, "replay", "", "serve Ring API calls from a recorded cassette instead of Ring")
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
+// configureClients sets up the HTTP client and websocket dialer from the environment.
+func configureClients() error {
+	config, err := httputil.ClientConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := httputil.Configure(config); err != nil {
+		return err
+	}
+	return wsutil.Configure(config)
+}
 
-		// Search config in home directory with name ".cobra-cmd" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigName(".cobra-cmd")
+// replay serves all Ring API calls from the cassette file.
+func replay(path string) error {
+	cassette, err := recorder.Load(path)
+	if err != nil {
+		return err
 	}
+	recorder.NewReplayer(cassette).Install()
+	return nil
+}
 
-	viper.AutomaticEnv() // read in environment variables that match
+// initConfig reads the selected profile from the config file and the RING_BRIDGE_ environment variables.
+func initConfig() error {
+	var err error
+	profile, err = config.Load(cfgFile, profileName)
+	if err != nil {
+		return err
+	}
+	httputil.Trace.Printf("Using config profile %v", profile.Name)
+	profile.AuditLog, err = homedir.Expand(profile.AuditLog)
+	if err != nil {
+		return err
+	}
+	sink, err := audit.New(profile.AuditLog)
+	if err != nil {
+		return fmt.Errorf("auditLog: %v", err)
+	}
+	audit.Default = sink
+	return nil
+}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+// auditCLI records a credential operation of the command line utility.
+func auditCLI(action string, err error, detail string) {
+	caller := "cli"
+	if current, userErr := user.Current(); userErr == nil {
+		caller = "cli:" + current.Username
+	}
+	event := audit.Event{Caller: audit.Caller{KeyName: caller}, Action: action, Result: audit.ResultSuccess, Detail: detail}
+	if err != nil {
+		event.Result = audit.ResultFailure
+		event.Detail = strings.TrimSpace(detail + " " + err.Error())
 	}
+	audit.Record(event)
 }
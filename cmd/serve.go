@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/config"
+	"github.com/asishrs/smartthings-ringalarmv2/credstore"
+	"github.com/asishrs/smartthings-ringalarmv2/stream"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/spf13/cobra"
+)
+
+// ConfigureServer applies the request checks of the config profile to Handler
+// and has it authenticate the requests with the token source, which is nil
+// without a refresh token. Set by main.
+var ConfigureServer func(config.Profile, *bridge.TokenSource) error
+
+// Handler answers the bridge API requests. main sets it to the Lambda handler
+// so the serve command answers exactly like the deployed Lambda.
+var Handler func(events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:          "serve",
+	Short:        "Run the bridge as an HTTP server instead of a Lambda",
+	SilenceUsage: true,
+	Long: `Serves the bridge API on the listen address of the config profile, so it can run
+on a machine in the house instead of AWS. POST /<action> (status, status/wait, home, 
+away, off, codes, device/<zid>/command and the others of the README) with the 
+same JSON body the Lambda accepts.
+
+TLS is used when the config profile has both server.tlsCert and server.tlsKey.
+
+Requests are authenticated with the refresh token of the config profile or the 
+credential store (see getRefreshKey), like the Lambda with RING_SECRET_BACKEND. 
+Without one every request must send its own accessToken.
+
+When server.signingKeys is set every request must be signed with one of the keys 
+(see signingKey). When server.apiKeys is set every request needs an API key with 
+the scope of the action (see apiKey).
+
+When webhooks.hooks is set serve keeps a websocket connection to Ring open and 
+posts the alarm events to the webhooks (see webhook).
+
+When server.events is set the same connection feeds GET /events (Server-Sent 
+Events) and GET /ws (websocket), which need the status:read scope. Both take 
+the zid, type and field filters and resume after lastEventId (or the 
+Last-Event-ID header), see the README.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if Handler == nil {
+			return errors.New("no request handler, serve must be started from the bridge binary")
+		}
+		listen := flagOrProfile(cmd, "listen", profile.Server.Listen)
+		if _, _, err := net.SplitHostPort(listen); err != nil {
+			return err
+		}
+		refreshToken, store, err := resolveRefreshToken(cmd)
+		if err == nil {
+			tokens = newTokenSource(refreshToken, store)
+		} else if err == errNoRefreshToken {
+			log.Println("No refresh token, requests must send their own accessToken")
+		} else {
+			return err
+		}
+		if ConfigureServer != nil {
+			if err := ConfigureServer(profile, tokens); err != nil {
+				return err
+			}
+		}
+		notifier, err := newNotifier()
+		if err != nil {
+			return err
+		}
+		handler := http.Handler(http.HandlerFunc(serveRequest))
+		if profile.Server.Events {
+			hub = stream.NewHub(stream.DefaultSize)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/events", serveStream("events", hub.ServeSSE))
+			mux.HandleFunc("/ws", serveStream("ws", hub.ServeWS))
+			mux.Handle("/", handler)
+			handler = mux
+		}
+		if notifier != nil || hub != nil {
+			if tokens == nil {
+				return errors.New("webhooks and events need a refresh token to watch Ring, see getRefreshKey")
+			}
+			connect := func() (string, string, error) {
+				accessToken, err := tokens.AccessToken()
+				if err != nil || profile.Location != "" {
+					return profile.Location, accessToken, err
+				}
+				location, err := bridge.Location(accessToken)
+				return location.ID, accessToken, err
+			}
+			// One Ring connection feeds the webhooks and every events client.
+			emit := func(locationID string, event alarmstate.Event) {
+				if notifier != nil {
+					notifier(locationID, event)
+				}
+				if hub != nil {
+					hub.Publish(locationID, event)
+				}
+			}
+			go follow(nil, connect, emit, log.Printf)
+		}
+		server := &http.Server{Addr: listen, Handler: handler}
+		log.Printf("Listening on %v", listen)
+		if profile.Server.TLSCert != "" {
+			return server.ListenAndServeTLS(profile.Server.TLSCert, profile.Server.TLSKey)
+		}
+		return server.ListenAndServe()
+	},
+}
+
+// hub relays the alarm events to the /events and /ws clients, nil unless server.events is set.
+var hub *stream.Hub
+
+// Authorize checks the signature and API key of an /events or /ws request
+// like Handler does, answering the response when it fails. Set by main.
+var Authorize func(request events.APIGatewayProxyRequest, action string) (events.APIGatewayProxyResponse, bool)
+
+// serveStream checks the signature and API key of a streaming request before
+// passing it to serve. Browsers can not set headers on EventSource, so the
+// API key may also be sent as the access_token query parameter.
+func serveStream(action string, serve http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		headers := flatten(r.Header)
+		if token := r.URL.Query().Get("access_token"); token != "" && headers["authorization"] == "" {
+			headers["authorization"] = "Bearer " + token
+		}
+		if Authorize != nil {
+			request := events.APIGatewayProxyRequest{
+				Path:           r.URL.Path,
+				HTTPMethod:     r.Method,
+				Headers:        headers,
+				PathParameters: map[string]string{"ring-action": strings.Trim(r.URL.Path, "/")},
+			}
+			response, ok := Authorize(request, action)
+			if !ok {
+				http.Error(w, response.Body, response.StatusCode)
+				return
+			}
+		}
+		serve(w, r)
+	}
+}
+
+// tokens authenticates the requests and the Ring connection of the webhooks
+// and events, nil when serve has no refresh token.
+var tokens *bridge.TokenSource
+
+// newTokenSource reads the refresh token from the credential store when it came from there.
+func newTokenSource(refreshToken string, store credstore.Store) *bridge.TokenSource {
+	if store == nil {
+		return &bridge.TokenSource{Load: func() (string, error) { return refreshToken, nil }}
+	}
+	return &bridge.TokenSource{
+		Load: func() (string, error) { return store.Get(profile.Name) },
+		Save: func(refreshToken string) error { return storeRotated(store, refreshToken) },
+	}
+}
+
+// serveRequest passes the HTTP request to Handler as an API Gateway request.
+func serveRequest(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	sourceIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+	request := events.APIGatewayProxyRequest{
+		Path:                  r.URL.Path,
+		HTTPMethod:            r.Method,
+		QueryStringParameters: map[string]string{},
+		PathParameters:        map[string]string{"ring-action": strings.Trim(r.URL.Path, "/")},
+		Body:                  string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{SourceIP: sourceIP},
+		},
+	}
+	request.Headers = flatten(r.Header)
+	for name := range r.URL.Query() {
+		request.QueryStringParameters[name] = r.URL.Query().Get(name)
+	}
+
+	response, err := Handler(request)
+	if err != nil {
+		log.Printf("Request %v failed - %v", r.URL.Path, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(response.StatusCode)
+	w.Write([]byte(response.Body))
+}
+
+// flatten returns the first value of each header, with lower case names as API Gateway passes them.
+func flatten(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for name := range header {
+		headers[strings.ToLower(name)] = header.Get(name)
+	}
+	return headers
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("listen", "", "host:port to listen on (default is server.listen of the config profile)")
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/asishrs/smartthings-ringalarmv2/signature"
+	"github.com/spf13/cobra"
+)
+
+// signingKeyCmd represents the signingKey command
+var signingKeyCmd = &cobra.Command{
+	Use:   "signingKey",
+	Short: "Manage the keys requests to the bridge are signed with",
+	Long: `Adds, lists and revokes the named HMAC keys the bridge checks request signatures 
+against. The keys are kept in a secrets backend:
+
+  ssm:<parameter name>          the RING_SIGNING_KEYS of the Lambda
+  secretsmanager:<secret id>    the RING_SIGNING_KEYS of the Lambda
+  file:<path>                   the server.signingKeys of serve
+
+A request is signed over its method, path, query, timestamp, nonce, the
+Idempotency-Key and If-None-Match headers and the body, so none of them can be
+changed on the way.
+
+--keys defaults to server.signingKeys of the config profile.`,
+}
+
+var signingKeyAddCmd = &cobra.Command{
+	Use:          "add <name>",
+	Short:        "Create a new signing key and print its secret",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, keys, err := signingKeys(cmd)
+		if err != nil {
+			return err
+		}
+		if _, ok := keys.Find(args[0]); ok {
+			return fmt.Errorf("signing key %v already exists, revoke it or pick another name", args[0])
+		}
+		key, err := signature.NewKey(args[0])
+		if err != nil {
+			return err
+		}
+		keys.Keys = append(keys.Keys, key)
+		err = signature.SaveKeys(backend, keys)
+		auditCLI("signingkey-add", err, key.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added signing key %v to %v.\nSecret - %v\n\n", key.Name, backend, key.Secret)
+		fmt.Println("*** WARNING *** \n The secret is not shown again. Anyone with it can sign requests, including disarming the alarm.")
+		return nil
+	},
+}
+
+var signingKeyListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the signing keys",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, keys, err := signingKeys(cmd)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCREATED\tREVOKED")
+		for _, key := range keys.Keys {
+			revoked := "-"
+			if key.Revoked != nil {
+				revoked = key.Revoked.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", key.Name, key.Created.Local().Format(time.RFC3339), revoked)
+		}
+		return w.Flush()
+	},
+}
+
+var signingKeyRevokeCmd = &cobra.Command{
+	Use:          "revoke <name>",
+	Short:        "Revoke a signing key",
+	Long:         `Revokes the key. The bridge stops accepting it once it reads the keys again, within a minute.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, keys, err := signingKeys(cmd)
+		if err != nil {
+			return err
+		}
+		found := false
+		for i, key := range keys.Keys {
+			if key.Name == args[0] && key.Revoked == nil {
+				now := time.Now().UTC()
+				keys.Keys[i].Revoked = &now
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no active signing key %v", args[0])
+		}
+		err = signature.SaveKeys(backend, keys)
+		auditCLI("signingkey-revoke", err, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked signing key %v in %v.\n", args[0], backend)
+		return nil
+	},
+}
+
+// signingKeys reads the keys of the --keys backend. A missing file holds no keys.
+func signingKeys(cmd *cobra.Command) (secrets.Backend, signature.KeySet, error) {
+	spec := flagOrProfile(cmd, "keys", profile.Server.SigningKeys)
+	if spec == "" {
+		return nil, signature.KeySet{}, errors.New("no signing keys backend, use --keys or set server.signingKeys in the config profile")
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return nil, signature.KeySet{}, err
+	}
+	keys, err := signature.LoadKeys(backend)
+	if _, isFile := backend.(secrets.File); isFile && os.IsNotExist(err) {
+		return backend, signature.KeySet{}, nil
+	}
+	return backend, keys, err
+}
+
+func init() {
+	rootCmd.AddCommand(signingKeyCmd)
+	signingKeyCmd.AddCommand(signingKeyAddCmd)
+	signingKeyCmd.AddCommand(signingKeyListCmd)
+	signingKeyCmd.AddCommand(signingKeyRevokeCmd)
+
+	signingKeyCmd.PersistentFlags().String("keys", "", "Secrets backend of the signing keys (default is server.signingKeys of the config profile)")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:          "status",
+	Short:        "Show the Ring Alarm mode and faulted sensors",
+	Long:         `Reads the security panel mode, the faulted sensors and the latest events from Ring.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		limit := profile.HistoryLimit
+		if cmd.Flag("historyLimit").Changed {
+			limit, _ = cmd.Flags().GetInt("historyLimit")
+		}
+		return printStatus(cmd, limit)
+	},
+}
+
+func printStatus(cmd *cobra.Command, limit int) error {
+	account, err := login(cmd)
+	if err != nil {
+		return err
+	}
+	status, err := bridge.Status(account.locationID, account.accessToken, limit)
+	if err != nil {
+		return err
+	}
+
+	mode := "unknown"
+	var faulted []string
+	for _, device := range status.DeviceStatus {
+		if device.Type == "security-panel" {
+			mode = bridge.ModeName(device.Mode)
+		}
+		if device.Faulted {
+			faulted = append(faulted, device.Name)
+		}
+	}
+
+	fmt.Printf("Mode    : %v\n", mode)
+	if len(faulted) == 0 {
+		fmt.Println("Faulted : none")
+	} else {
+		fmt.Printf("Faulted : %d\n", len(faulted))
+		for _, name := range faulted {
+			fmt.Printf("  - %v\n", name)
+		}
+	}
+	if limit > 0 {
+		fmt.Println("Events  :")
+		// The first event is the refresh time added by the bridge.
+		for _, event := range status.Events[1:] {
+			fmt.Printf("  %v  %-30v %v\n", time.Unix(0, event.Time*int64(time.Millisecond)).Format("2006-01-02 15:04:05"), event.DeviceName, event.Type)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	addRingFlags(statusCmd)
+	statusCmd.Flags().IntP("historyLimit", "l", 5, "Number of recent events to show (default is the historyLimit of the config profile)")
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/credstore"
+	"github.com/spf13/cobra"
+)
+
+// tokenCmd represents the token command
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage the stored Ring Refresh Token",
+	Long: `Shows or rotates the refresh token of the config profile in the credential 
+store. getRefreshKey stores the token and logout removes it.`,
+}
+
+// tokenShowCmd represents the token show command
+var tokenShowCmd = &cobra.Command{
+	Use:          "show",
+	Short:        "Show the stored Ring Refresh Token",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, token, err := storedToken()
+		if err != nil {
+			return err
+		}
+		if reveal, _ := cmd.Flags().GetBool("reveal"); !reveal {
+			token = maskToken(token)
+		}
+		fmt.Printf("Profile: %v\nStore:   %v\nToken:   %v\n", profile.Name, store, token)
+		return nil
+	},
+}
+
+// tokenRotateCmd represents the token rotate command
+var tokenRotateCmd = &cobra.Command{
+	Use:          "rotate",
+	Short:        "Replace the stored Ring Refresh Token with a new one",
+	SilenceUsage: true,
+	Long: `Exchanges the stored refresh token with Ring for a new one and stores the new 
+token. Update the RingAlarm Smartthings App when it uses the old token.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, token, err := storedToken()
+		if err != nil {
+			return err
+		}
+		_, newToken, err := bridge.AccessToken(token)
+		if err == bridge.ErrAccessDenied {
+			return errors.New("Ring refused the stored refresh token, get a new one with getRefreshKey")
+		}
+		if err != nil {
+			return err
+		}
+		if newToken == "" || newToken == token {
+			return errors.New("Ring did not return a new refresh token")
+		}
+		err = store.Set(profile.Name, newToken)
+		auditCLI("token-rotate", err, store.String())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotated the Refresh Token of profile %v in %v.\n", profile.Name, store)
+		return nil
+	},
+}
+
+// storedToken returns the credential store and the token of the profile in it.
+func storedToken() (credstore.Store, string, error) {
+	store, err := credentialStore()
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := store.Get(profile.Name)
+	if err == credstore.ErrNotFound {
+		return nil, "", fmt.Errorf("no Refresh Token stored for profile %v in %v, log in with getRefreshKey", profile.Name, store)
+	}
+	return store, token, err
+}
+
+// maskToken shows only the last characters of the token.
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", 8) + token[len(token)-4:]
+}
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenShowCmd)
+	tokenCmd.AddCommand(tokenRotateCmd)
+
+	tokenShowCmd.Flags().Bool("reveal", false, "Print the whole token instead of its last characters")
+}
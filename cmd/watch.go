@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/spf13/cobra"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream live Ring Alarm events",
+	Long: `Keeps a websocket connection to Ring open and prints every device update as 
+it happens, e.g. a door opening or the alarm mode changing. The connection is 
+opened again when Ring drops it. Stop with Ctrl+C.
+
+With --webhooks the events are also posted to the webhooks of the config 
+profile (see webhook).`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jsonLines, _ := cmd.Flags().GetBool("json")
+		return watch(cmd, jsonLines)
+	},
+}
+
+// errStopped is returned once watch is interrupted.
+var errStopped = errors.New("stopped")
+
+func watch(cmd *cobra.Command, jsonLines bool) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	show := printEvent
+	if jsonLines {
+		encoder := json.NewEncoder(os.Stdout)
+		show = func(event alarmstate.Event) { encoder.Encode(event) }
+	}
+	emit := func(locationID string, event alarmstate.Event) { show(event) }
+	if notify, _ := cmd.Flags().GetBool("webhooks"); notify {
+		notifier, err := newNotifier()
+		if err != nil {
+			return err
+		}
+		if notifier == nil {
+			return errors.New("no webhooks backend, set webhooks.hooks in the config profile")
+		}
+		emit = func(locationID string, event alarmstate.Event) {
+			show(event)
+			notifier(locationID, event)
+		}
+	}
+
+	connect := func() (string, string, error) {
+		// Logging in again also renews the access token, which expires while watching.
+		account, err := login(cmd)
+		return account.locationID, account.accessToken, err
+	}
+	logf := func(format string, args ...interface{}) { fmt.Fprintf(os.Stderr, format+"\n", args...) }
+	follow(interrupt, connect, emit, logf)
+	return nil
+}
+
+// follow passes the device events of the location to emit until stop receives.
+// The websocket connection is opened again when Ring drops it, with connect
+// returning the location and a fresh access token every time.
+func follow(stop <-chan os.Signal, connect func() (string, string, error), emit func(string, alarmstate.Event), logf func(string, ...interface{})) {
+	delay := time.Second
+	for {
+		started := time.Now()
+		err := followSession(stop, connect, emit, logf)
+		if err == errStopped {
+			return
+		}
+		if time.Since(started) > time.Minute {
+			delay = time.Second
+		}
+		logf("Connection to Ring lost (%v), reconnecting in %v", err, delay)
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// followSession passes events until the websocket connection ends or stop receives.
+func followSession(stop <-chan os.Signal, connect func() (string, string, error), emit func(string, alarmstate.Event), logf func(string, ...interface{})) error {
+	locationID, accessToken, err := connect()
+	if err != nil {
+		return err
+	}
+	ring := bridge.NewSession(locationID, accessToken)
+	defer ring.Close()
+
+	session, err := ring.Open()
+	if err != nil {
+		return err
+	}
+	updates, cancel := session.Subscribe()
+	defer cancel()
+
+	devices, err := session.DeviceList()
+	if err != nil {
+		return err
+	}
+	tracker := alarmstate.NewTracker(devices)
+	logf("Watching %d devices", len(devices.Body))
+
+	for {
+		select {
+		case <-stop:
+			return errStopped
+		case update, ok := <-updates:
+			if !ok {
+				if err := session.Err(); err != nil {
+					return err
+				}
+				return errors.New("connection closed")
+			}
+			for _, event := range tracker.Apply(update) {
+				emit(locationID, event)
+			}
+		}
+	}
+}
+
+func printEvent(event alarmstate.Event) {
+	var changes []string
+	for _, change := range event.Changes {
+		if change.Field == "mode" {
+			changes = append(changes, fmt.Sprintf("mode: %v -> %v", bridge.ModeName(change.From), bridge.ModeName(change.To)))
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%v: %v -> %v", change.Field, change.From, change.To))
+	}
+	fmt.Printf("%v  %-30v %-20v %v\n", event.Time.Format("2006-01-02 15:04:05"), event.DeviceName, event.DeviceType, strings.Join(changes, ", "))
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	addRingFlags(watchCmd)
+	watchCmd.Flags().Bool("json", false, "Print one JSON object per event (JSON lines)")
+	watchCmd.Flags().Bool("webhooks", false, "Also send the events to the webhooks of the config profile")
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/asishrs/smartthings-ringalarmv2/webhook"
+	"github.com/spf13/cobra"
+)
+
+// webhookCmd represents the webhook command
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage the URLs notified of alarm events",
+	Long: `Adds, lists, tests and removes the webhooks the bridge posts alarm events to.
+Each webhook subscribes to some of the events:
+
+  mode-change       the security panel switched between Disarmed, Home and Away
+  sensor-faulted    a contact or motion sensor faulted, e.g. a door opened
+  alarm-triggered   the alarm went off
+  battery-low       the battery of a device is low
+
+Every POST is signed with the secret of the webhook, see the README.
+
+The webhooks are kept in a secrets backend, the RING_WEBHOOKS of the Lambda
+(ssm:<parameter name> or secretsmanager:<secret id>) or the webhooks.hooks of
+serve and watch (file:<path>). --hooks defaults to webhooks.hooks of the config
+profile.`,
+}
+
+var webhookAddCmd = &cobra.Command{
+	Use:          "add <name>",
+	Short:        "Register a URL and print its signing secret",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, hooks, err := webhooks(cmd)
+		if err != nil {
+			return err
+		}
+		if _, ok := hooks.Find(args[0]); ok {
+			return fmt.Errorf("webhook %v already exists, remove it or pick another name", args[0])
+		}
+		url, _ := cmd.Flags().GetString("url")
+		events, _ := cmd.Flags().GetStringSlice("event")
+		hook, err := webhook.NewHook(args[0], url, events)
+		if err != nil {
+			return err
+		}
+		hooks.Hooks = append(hooks.Hooks, hook)
+		err = webhook.SaveHooks(backend, hooks)
+		auditCLI("webhook-add", err, hook.Name+" "+hook.URL+" "+strings.Join(hook.Events, ","))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added webhook %v (%v) to %v.\nSecret - %v\n\n", hook.Name, strings.Join(hook.Events, ", "), backend, hook.Secret)
+		fmt.Println("Check the " + webhook.HeaderSignature + " header of each POST with this secret.")
+		return nil
+	},
+}
+
+var webhookListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the webhooks",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, hooks, err := webhooks(cmd)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tURL\tEVENTS\tCREATED")
+		for _, hook := range hooks.Hooks {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", hook.Name, hook.URL, strings.Join(hook.Events, ","), hook.Created.Local().Format(time.RFC3339))
+		}
+		return w.Flush()
+	},
+}
+
+var webhookRemoveCmd = &cobra.Command{
+	Use:          "remove <name>",
+	Short:        "Remove a webhook",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backend, hooks, err := webhooks(cmd)
+		if err != nil {
+			return err
+		}
+		kept := hooks.Hooks[:0]
+		for _, hook := range hooks.Hooks {
+			if hook.Name != args[0] {
+				kept = append(kept, hook)
+			}
+		}
+		if len(kept) == len(hooks.Hooks) {
+			return fmt.Errorf("no webhook %v", args[0])
+		}
+		hooks.Hooks = kept
+		err = webhook.SaveHooks(backend, hooks)
+		auditCLI("webhook-remove", err, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed webhook %v from %v.\n", args[0], backend)
+		return nil
+	},
+}
+
+var webhookTestCmd = &cobra.Command{
+	Use:          "test <name>",
+	Short:        "Send a test event to a webhook",
+	Long:         `Posts a made up mode-change event to the webhook once, to check the receiver and its signature check.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, hooks, err := webhooks(cmd)
+		if err != nil {
+			return err
+		}
+		hook, ok := hooks.Find(args[0])
+		if !ok {
+			return fmt.Errorf("no webhook %v", args[0])
+		}
+		notification := webhook.Notifications(profile.Location, []alarmstate.Event{{
+			Time:       time.Now(),
+			ZID:        "test",
+			DeviceName: "Test",
+			DeviceType: "security-panel",
+			Changes:    []alarmstate.Change{{Field: "mode", From: "none", To: "some"}},
+		}})[0]
+		dispatcher := &webhook.Dispatcher{Retry: webhook.DefaultRetry, Client: httputil.Client}
+		dispatcher.Retry.Attempts = 1
+		if err := dispatcher.Deliver(hook, notification); err != nil {
+			return err
+		}
+		fmt.Printf("Webhook %v accepted test event %v.\n", hook.Name, notification.ID)
+		return nil
+	},
+}
+
+// webhooks reads the hooks of the --hooks backend. A missing file holds no hooks.
+func webhooks(cmd *cobra.Command) (secrets.Backend, webhook.HookSet, error) {
+	spec := flagOrProfile(cmd, "hooks", profile.Webhooks.Hooks)
+	if spec == "" {
+		return nil, webhook.HookSet{}, errors.New("no webhooks backend, use --hooks or set webhooks.hooks in the config profile")
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return nil, webhook.HookSet{}, err
+	}
+	hooks, err := webhook.LoadHooks(backend)
+	if _, isFile := backend.(secrets.File); isFile && os.IsNotExist(err) {
+		return backend, webhook.HookSet{}, nil
+	}
+	return backend, hooks, err
+}
+
+// newDispatcher returns a dispatcher for the webhooks of the profile, nil when the profile has none.
+func newDispatcher() (*webhook.Dispatcher, error) {
+	if profile.Webhooks.Hooks == "" {
+		return nil, nil
+	}
+	backend, err := secrets.New(profile.Webhooks.Hooks)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks.hooks: %v", err)
+	}
+	if _, err := webhook.LoadHooks(backend); err != nil {
+		return nil, err
+	}
+	deadLetters, err := webhook.NewDeadLetterSink(profile.Webhooks.DeadLetters)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks.deadLetters: %v", err)
+	}
+	log.Printf("Sending alarm events to the webhooks of %v", backend)
+	return &webhook.Dispatcher{Backend: backend, HooksTTL: time.Minute, DeadLetters: deadLetters, Client: httputil.Client}, nil
+}
+
+// newNotifier returns a function passing device events to the webhooks of the
+// profile, nil when the profile has none. The events are delivered in order
+// by one goroutine, so a slow receiver does not hold up the websocket.
+func newNotifier() (func(locationID string, event alarmstate.Event), error) {
+	dispatcher, err := newDispatcher()
+	if err != nil || dispatcher == nil {
+		return nil, err
+	}
+
+	queue := make(chan []webhook.Notification, 100)
+	go func() {
+		for notifications := range queue {
+			dispatcher.Notify(notifications)
+		}
+	}()
+	return func(locationID string, event alarmstate.Event) {
+		notifications := webhook.Notifications(locationID, []alarmstate.Event{event})
+		if len(notifications) == 0 {
+			return
+		}
+		select {
+		case queue <- notifications:
+		default:
+			log.Printf("Webhook queue is full, dropping %v of %v", notifications[0].Kind, event.DeviceName)
+		}
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+	webhookCmd.AddCommand(webhookAddCmd)
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookRemoveCmd)
+	webhookCmd.AddCommand(webhookTestCmd)
+
+	webhookCmd.PersistentFlags().String("hooks", "", "Secrets backend of the webhooks (default is webhooks.hooks of the config profile)")
+	webhookAddCmd.Flags().String("url", "", "URL to POST the events to")
+	webhookAddCmd.Flags().StringSlice("event", nil, "Event to send, repeat or comma separate: "+strings.Join(webhook.AllEvents, ", "))
+	webhookAddCmd.MarkFlagRequired("url")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// getAccessCodes answers codes, the keypad codes of the location without the digits.
+func getAccessCodes(apiRequest public.Request) (events.APIGatewayProxyResponse, error) {
+	codes, err := bridge.AccessCodes(apiRequest.LocationID, apiRequest.AccessToken)
+	if err != nil {
+		return codeError(err)
+	}
+	return sendResponse(public.AccessCodesResponse{Codes: codes})
+}
+
+// changeAccessCode answers codes/add, codes/update and codes/remove. A new or
+// changed code can disarm the alarm, so adding and updating need the disarm
+// code when there is a disarm policy.
+func changeAccessCode(apiRequest public.Request, action string, event *audit.Event) (events.APIGatewayProxyResponse, error) {
+	code := apiRequest.AccessCode
+	// The digits are never written to the audit log.
+	event.Detail = code.Name
+	if code.ID != "" {
+		event.Detail = code.ID + " " + code.Name
+	}
+	if action != "codes/remove" {
+		if response, ok := checkDisarm(apiRequest, event.Caller); !ok {
+			return response, nil
+		}
+	}
+
+	var changed public.AccessCode
+	var err error
+	switch action {
+	case "codes/add":
+		changed, err = bridge.AddAccessCode(apiRequest.LocationID, apiRequest.AccessToken, code)
+	case "codes/update":
+		changed, err = bridge.UpdateAccessCode(apiRequest.LocationID, apiRequest.AccessToken, codeIDOrName(code), code)
+	default:
+		changed, err = bridge.RemoveAccessCode(apiRequest.LocationID, apiRequest.AccessToken, codeIDOrName(code))
+	}
+	if err != nil {
+		return codeError(err)
+	}
+	return sendResponse(public.AccessCodesResponse{Codes: []public.AccessCode{changed}})
+}
+
+// codeIDOrName picks the code to update or remove, by id when it is given.
+func codeIDOrName(code public.AccessCode) string {
+	if code.ID != "" {
+		return code.ID
+	}
+	return code.Name
+}
+
+// codeError answers 400 with the reason for a code Ring would not accept.
+func codeError(err error) (events.APIGatewayProxyResponse, error) {
+	var invalid *bridge.InvalidCodeError
+	if errors.As(err, &invalid) || err == bridge.ErrNoVault {
+		return sendResponse(public.ProcessError{Code: http.StatusBadRequest, Message: err.Error()})
+	}
+	return ringError(err)
+}
@@ -0,0 +1,375 @@
+// Package config reads the command line and server configuration file.
+//
+// The file holds named profiles, e.g. ~/.config/ring-bridge/config.yaml:
+//
+//	defaultProfile: home
+//	profiles:
+//	  home:
+//	    refreshToken: <refresh token>
+//	    location: <location id>
+//	    zid: <security panel zid>
+//	    historyLimit: 10
+//	    output: table
+//	    endpoint: https://xxxx.execute-api.us-east-1.amazonaws.com/v1
+//	    apiKey: <api gateway key>
+//	    bridgeKey: <bridge api key>
+//	    signingKey: <name>:<secret>
+//	    server:
+//	      listen: 127.0.0.1:8080
+//	      tlsCert: /path/cert.pem
+//	      tlsKey: /path/key.pem
+//	      signingKeys: file:/path/signing-keys.json
+//	      signatureWindow: 5m
+//	      apiKeys: file:/path/api-keys.json
+//	      disarmPolicy: file:/path/disarm-policy.json
+//	    auditLog: file:~/.config/ring-bridge/audit.jsonl
+//	    credentials:
+//	      store: file
+//	      file: ~/.config/ring-bridge/credentials.enc
+//	      keyFile: /path/credentials.key
+//
+// Every value of the selected profile can be overridden with an environment
+// variable prefixed with RING_BRIDGE_, see EnvVars.
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding the profile.
+const EnvPrefix = "RING_BRIDGE_"
+
+// DefaultProfileName is used when neither the flag, RING_BRIDGE_PROFILE nor the file names a profile.
+const DefaultProfileName = "default"
+
+// OutputFormats are the valid values of Profile.Output.
+var OutputFormats = []string{"table", "json", "yaml", "csv"}
+
+// CredentialStores are the valid values of Credentials.Store.
+var CredentialStores = []string{"auto", "keyring", "file"}
+
+// Server holds the settings of the serve command.
+type Server struct {
+	Listen  string `mapstructure:"listen"`
+	TLSCert string `mapstructure:"tlsCert"`
+	TLSKey  string `mapstructure:"tlsKey"`
+	// SigningKeys is the secrets backend spec of the request signing keys, see package signature.
+	SigningKeys     string        `mapstructure:"signingKeys"`
+	SignatureWindow time.Duration `mapstructure:"signatureWindow"`
+	// APIKeys is the secrets backend spec of the scoped API keys, see package apikey.
+	APIKeys string `mapstructure:"apiKeys"`
+	// DisarmPolicy is the secrets backend spec of the disarm PIN or TOTP secret, see package disarm.
+	DisarmPolicy string `mapstructure:"disarmPolicy"`
+	// Events serves the alarm events on /events and /ws, see package stream.
+	Events bool `mapstructure:"events"`
+}
+
+// Webhooks holds where the webhooks of serve and watch are kept, see package webhook.
+type Webhooks struct {
+	// Hooks is the secrets backend spec of the registered webhooks.
+	Hooks string `mapstructure:"hooks"`
+	// DeadLetters is the sink spec of the deliveries that failed.
+	DeadLetters string `mapstructure:"deadLetters"`
+}
+
+// Poller holds where the poll command keeps its state and sends the changes, see package poller.
+type Poller struct {
+	// Store is the spec of the state store.
+	Store string `mapstructure:"store"`
+	// Sinks is the comma separated spec of the sinks.
+	Sinks string `mapstructure:"sinks"`
+}
+
+// Credentials holds where the refresh token of the profile is stored, see package credstore.
+type Credentials struct {
+	Store   string `mapstructure:"store"`
+	File    string `mapstructure:"file"`
+	KeyFile string `mapstructure:"keyFile"`
+}
+
+// Profile is one Ring account and the defaults used with it.
+type Profile struct {
+	Name         string `mapstructure:"-"`
+	RefreshToken string `mapstructure:"refreshToken"`
+	Location     string `mapstructure:"location"`
+	ZID          string `mapstructure:"zid"`
+	HistoryLimit int    `mapstructure:"historyLimit"`
+	Output       string `mapstructure:"output"`
+	Endpoint     string `mapstructure:"endpoint"`
+	APIKey       string `mapstructure:"apiKey"`
+	// BridgeKey is the scoped API key of the bridge that doctor sends to the endpoint, see package apikey.
+	BridgeKey string `mapstructure:"bridgeKey"`
+	// SigningKey is the <name>:<secret> key that doctor signs its endpoint request with, see package signature.
+	SigningKey  string      `mapstructure:"signingKey"`
+	Server      Server      `mapstructure:"server"`
+	Credentials Credentials `mapstructure:"credentials"`
+	Webhooks    Webhooks    `mapstructure:"webhooks"`
+	Poller      Poller      `mapstructure:"poller"`
+	// AuditLog is the audit sink spec of serve and the credential commands, see package audit.
+	AuditLog string `mapstructure:"auditLog"`
+}
+
+// File is the layout of the configuration file.
+type File struct {
+	DefaultProfile string             `mapstructure:"defaultProfile"`
+	Profiles       map[string]Profile `mapstructure:"profiles"`
+}
+
+// EnvVars maps the environment variables to the profile value they override.
+var EnvVars = map[string]func(*Profile, string) error{
+	EnvPrefix + "REFRESH_TOKEN": func(p *Profile, v string) error { p.RefreshToken = v; return nil },
+	EnvPrefix + "LOCATION":      func(p *Profile, v string) error { p.Location = v; return nil },
+	EnvPrefix + "ZID":           func(p *Profile, v string) error { p.ZID = v; return nil },
+	EnvPrefix + "HISTORY_LIMIT": func(p *Profile, v string) error {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		p.HistoryLimit = limit
+		return nil
+	},
+	EnvPrefix + "OUTPUT":              func(p *Profile, v string) error { p.Output = v; return nil },
+	EnvPrefix + "ENDPOINT":            func(p *Profile, v string) error { p.Endpoint = v; return nil },
+	EnvPrefix + "API_KEY":             func(p *Profile, v string) error { p.APIKey = v; return nil },
+	EnvPrefix + "BRIDGE_KEY":          func(p *Profile, v string) error { p.BridgeKey = v; return nil },
+	EnvPrefix + "SIGNING_KEY":         func(p *Profile, v string) error { p.SigningKey = v; return nil },
+	EnvPrefix + "SERVER_LISTEN":       func(p *Profile, v string) error { p.Server.Listen = v; return nil },
+	EnvPrefix + "SERVER_TLS_CERT":     func(p *Profile, v string) error { p.Server.TLSCert = v; return nil },
+	EnvPrefix + "SERVER_TLS_KEY":      func(p *Profile, v string) error { p.Server.TLSKey = v; return nil },
+	EnvPrefix + "SERVER_SIGNING_KEYS": func(p *Profile, v string) error { p.Server.SigningKeys = v; return nil },
+	EnvPrefix + "SERVER_SIGNATURE_WINDOW": func(p *Profile, v string) error {
+		window, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("must be a duration, e.g. 5m")
+		}
+		p.Server.SignatureWindow = window
+		return nil
+	},
+	EnvPrefix + "SERVER_API_KEYS":      func(p *Profile, v string) error { p.Server.APIKeys = v; return nil },
+	EnvPrefix + "SERVER_DISARM_POLICY": func(p *Profile, v string) error { p.Server.DisarmPolicy = v; return nil },
+	EnvPrefix + "SERVER_EVENTS": func(p *Profile, v string) error {
+		events, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		p.Server.Events = events
+		return nil
+	},
+	EnvPrefix + "AUDIT_LOG":             func(p *Profile, v string) error { p.AuditLog = v; return nil },
+	EnvPrefix + "WEBHOOKS":              func(p *Profile, v string) error { p.Webhooks.Hooks = v; return nil },
+	EnvPrefix + "WEBHOOKS_DEAD_LETTERS": func(p *Profile, v string) error { p.Webhooks.DeadLetters = v; return nil },
+	EnvPrefix + "POLLER_STORE":          func(p *Profile, v string) error { p.Poller.Store = v; return nil },
+	EnvPrefix + "POLLER_SINKS":          func(p *Profile, v string) error { p.Poller.Sinks = v; return nil },
+	EnvPrefix + "CREDENTIALS_STORE":     func(p *Profile, v string) error { p.Credentials.Store = v; return nil },
+	EnvPrefix + "CREDENTIALS_FILE":      func(p *Profile, v string) error { p.Credentials.File = v; return nil },
+	EnvPrefix + "CREDENTIALS_KEY_FILE":  func(p *Profile, v string) error { p.Credentials.KeyFile = v; return nil },
+}
+
+// Dir returns $XDG_CONFIG_HOME/ring-bridge, or ~/.config/ring-bridge when
+// XDG_CONFIG_HOME is not set.
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "ring-bridge"), nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "ring-bridge"), nil
+}
+
+// DefaultPath returns config.yaml in Dir.
+func DefaultPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load reads the profile from the configuration file, applies the environment
+// overrides and validates it. An empty path reads the default path, which may
+// not exist. An empty name selects RING_BRIDGE_PROFILE, then the defaultProfile
+// of the file, then "default".
+func Load(path string, name string) (Profile, error) {
+	file, path, err := readFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if name == "" {
+		name = os.Getenv(EnvPrefix + "PROFILE")
+	}
+	if name == "" {
+		name = file.DefaultProfile
+	}
+	explicit := name != ""
+	if name == "" {
+		name = DefaultProfileName
+	}
+	// Keys are case-insensitive in the file.
+	name = strings.ToLower(name)
+
+	profile, ok := file.Profiles[name]
+	if !ok && explicit {
+		return Profile{}, fmt.Errorf("profile %q not found in %v, available profiles: %v", name, path, profileNames(file))
+	}
+	profile.Name = name
+	if err := profile.setDefaults(); err != nil {
+		return Profile{}, err
+	}
+
+	// RING_REFRESH_TOKEN was read before the configuration file existed.
+	if value, ok := os.LookupEnv("RING_REFRESH_TOKEN"); ok {
+		profile.RefreshToken = value
+	}
+	for env, set := range EnvVars {
+		if value, ok := os.LookupEnv(env); ok {
+			if err := set(&profile, value); err != nil {
+				return Profile{}, fmt.Errorf("%v: %v", env, err)
+			}
+		}
+	}
+	if err := profile.Validate(); err != nil {
+		return Profile{}, fmt.Errorf("profile %q: %v", name, err)
+	}
+	return profile, nil
+}
+
+func readFile(path string) (File, string, error) {
+	explicit := path != ""
+	if !explicit {
+		defaultPath, err := DefaultPath()
+		if err != nil {
+			return File{}, "", err
+		}
+		path = defaultPath
+	}
+
+	var file File
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) && !explicit {
+			return file, path, nil
+		}
+		return File{}, path, fmt.Errorf("unable to read config %v: %v", path, err)
+	}
+	if err := v.UnmarshalExact(&file); err != nil {
+		return File{}, path, fmt.Errorf("invalid config %v: %v", path, err)
+	}
+	return file, path, nil
+}
+
+func profileNames(file File) string {
+	if len(file.Profiles) == 0 {
+		return "none"
+	}
+	var names []string
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (p *Profile) setDefaults() error {
+	if p.HistoryLimit == 0 {
+		p.HistoryLimit = 5
+	}
+	if p.Output == "" {
+		p.Output = "table"
+	}
+	if p.Server.Listen == "" {
+		p.Server.Listen = "127.0.0.1:8080"
+	}
+	if p.Server.SignatureWindow == 0 {
+		p.Server.SignatureWindow = 5 * time.Minute
+	}
+	if p.Credentials.Store == "" {
+		p.Credentials.Store = "auto"
+	}
+	if p.Credentials.File == "" {
+		dir, err := Dir()
+		if err != nil {
+			return err
+		}
+		p.Credentials.File = filepath.Join(dir, "credentials.enc")
+	}
+	if p.Poller.Store == "" {
+		dir, err := Dir()
+		if err != nil {
+			return err
+		}
+		p.Poller.Store = "file:" + filepath.Join(dir, "poller")
+	}
+	var err error
+	if p.Credentials.File, err = homedir.Expand(p.Credentials.File); err != nil {
+		return err
+	}
+	p.Credentials.KeyFile, err = homedir.Expand(p.Credentials.KeyFile)
+	return err
+}
+
+// Validate reports the first invalid value of the profile. The backend, store
+// and sink specs are checked by their packages when they are used.
+func (p Profile) Validate() error {
+	if p.HistoryLimit < 0 || p.HistoryLimit > 50 {
+		return fmt.Errorf("historyLimit %d must be between 0 and 50", p.HistoryLimit)
+	}
+	valid := false
+	for _, format := range OutputFormats {
+		valid = valid || p.Output == format
+	}
+	if !valid {
+		return fmt.Errorf("output %q must be one of %v", p.Output, strings.Join(OutputFormats, ", "))
+	}
+	if p.Endpoint != "" {
+		endpoint, err := url.Parse(p.Endpoint)
+		if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+			return fmt.Errorf("endpoint %q must be an http(s) url", p.Endpoint)
+		}
+	}
+	if _, _, err := net.SplitHostPort(p.Server.Listen); err != nil {
+		return fmt.Errorf("server.listen %q must be host:port, e.g. 127.0.0.1:8080", p.Server.Listen)
+	}
+	if (p.Server.TLSCert == "") != (p.Server.TLSKey == "") {
+		return fmt.Errorf("server.tlsCert and server.tlsKey must be set together")
+	}
+	for _, file := range []string{p.Server.TLSCert, p.Server.TLSKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("server TLS file: %v", err)
+		}
+	}
+	if p.Server.SignatureWindow < 0 {
+		return fmt.Errorf("server.signatureWindow %v must be positive", p.Server.SignatureWindow)
+	}
+	valid = false
+	for _, store := range CredentialStores {
+		valid = valid || p.Credentials.Store == store
+	}
+	if !valid {
+		return fmt.Errorf("credentials.store %q must be one of %v", p.Credentials.Store, strings.Join(CredentialStores, ", "))
+	}
+	if p.Credentials.KeyFile != "" {
+		if _, err := os.Stat(p.Credentials.KeyFile); err != nil {
+			return fmt.Errorf("credentials.keyFile: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package credstore keeps the Ring refresh tokens of the command line utility
+// encrypted at rest, in the OS keyring or in an encrypted file.
+package credstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Service is the keyring service the tokens are stored under.
+const Service = "ring-bridge"
+
+// ErrNotFound is returned when no refresh token is stored for the profile.
+var ErrNotFound = errors.New("no refresh token stored")
+
+// Store holds one refresh token per profile.
+type Store interface {
+	Get(profile string) (string, error)
+	Set(profile, token string) error
+	Delete(profile string) error
+	// String describes where the tokens are kept.
+	String() string
+}
+
+// Options selects the store, see Open.
+type Options struct {
+	// Store is auto, keyring or file.
+	Store string
+	// File is the path of the encrypted file.
+	File string
+	// KeyFile encrypts the file with its content instead of a passphrase.
+	KeyFile string
+	// Passphrase is asked for when the file is encrypted with a passphrase.
+	Passphrase func() (string, error)
+}
+
+// Open returns the store of the options. auto uses the OS keyring when one is
+// available and the encrypted file otherwise.
+func Open(options Options) (Store, error) {
+	switch options.Store {
+	case "keyring":
+		return Keyring{}, nil
+	case "file":
+		return openFile(options), nil
+	case "auto", "":
+		if options.KeyFile == "" && KeyringAvailable() {
+			return Keyring{}, nil
+		}
+		return openFile(options), nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %q", options.Store)
+	}
+}
+
+func openFile(options Options) *File {
+	if options.KeyFile != "" {
+		return NewKeyFile(options.File, options.KeyFile)
+	}
+	return NewPassphraseFile(options.File, options.Passphrase)
+}
+
+// Keyring stores the tokens in the OS keyring (Keychain, Secret Service or Windows Credential Manager).
+type Keyring struct{}
+
+// KeyringAvailable reports whether the OS keyring can be used.
+func KeyringAvailable() bool {
+	_, err := keyring.Get(Service, "availability-check")
+	return err == nil || err == keyring.ErrNotFound
+}
+
+// Get returns the token of the profile.
+func (Keyring) Get(profile string) (string, error) {
+	token, err := keyring.Get(Service, profile)
+	if err == keyring.ErrNotFound {
+		return "", ErrNotFound
+	}
+	return token, err
+}
+
+// Set stores the token of the profile.
+func (Keyring) Set(profile, token string) error {
+	return keyring.Set(Service, profile, token)
+}
+
+// Delete removes the token of the profile.
+func (Keyring) Delete(profile string) error {
+	err := keyring.Delete(Service, profile)
+	if err == keyring.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (Keyring) String() string {
+	return "OS keyring"
+}
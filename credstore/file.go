@@ -0,0 +1,249 @@
+package credstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation of the encrypted file.
+const (
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "keyfile"
+)
+
+// scrypt cost parameters, the recommended interactive values.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// minKeyFileSize is the least random data a key file must hold.
+const minKeyFileSize = 32
+
+// ErrWrongKey is returned when the file cannot be decrypted with the passphrase or key file.
+var ErrWrongKey = errors.New("unable to decrypt the credential file, wrong passphrase or key file")
+
+// envelope is the layout of the encrypted file. Data is the AES-256-GCM
+// encrypted JSON map of profile to refresh token.
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// File stores the tokens in a file encrypted with a key derived from a passphrase or a key file.
+type File struct {
+	path   string
+	kdf    string
+	secret func() ([]byte, error)
+}
+
+// NewPassphraseFile returns the file at path encrypted with the passphrase.
+// The passphrase is only asked for when the file is read or written.
+func NewPassphraseFile(path string, passphrase func() (string, error)) *File {
+	return &File{path: path, kdf: kdfScrypt, secret: func() ([]byte, error) {
+		if passphrase == nil {
+			return nil, errors.New("no passphrase for the credential file")
+		}
+		value, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			return nil, errors.New("empty passphrase for the credential file")
+		}
+		return []byte(value), nil
+	}}
+}
+
+// NewKeyFile returns the file at path encrypted with the content of keyFile,
+// which must hold at least 32 random bytes, e.g. head -c 32 /dev/urandom.
+func NewKeyFile(path, keyFile string) *File {
+	return &File{path: path, kdf: kdfKeyFile, secret: func() ([]byte, error) {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) < minKeyFileSize {
+			return nil, fmt.Errorf("key file %v must hold at least %d bytes", keyFile, minKeyFileSize)
+		}
+		return key, nil
+	}}
+}
+
+// Get returns the token of the profile.
+func (f *File) Get(profile string) (string, error) {
+	tokens, _, err := f.read()
+	if err != nil {
+		return "", err
+	}
+	token, ok := tokens[profile]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+// Set stores the token of the profile.
+func (f *File) Set(profile, token string) error {
+	tokens, secret, err := f.read()
+	if err != nil {
+		return err
+	}
+	tokens[profile] = token
+	return f.write(tokens, secret)
+}
+
+// Delete removes the token of the profile.
+func (f *File) Delete(profile string) error {
+	tokens, secret, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[profile]; !ok {
+		return ErrNotFound
+	}
+	delete(tokens, profile)
+	return f.write(tokens, secret)
+}
+
+func (f *File) String() string {
+	if f.kdf == kdfKeyFile {
+		return f.path + " (key file)"
+	}
+	return f.path + " (passphrase)"
+}
+
+// read decrypts the file. A missing file holds no tokens.
+func (f *File) read() (map[string]string, []byte, error) {
+	tokens := map[string]string{}
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return tokens, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, nil, fmt.Errorf("invalid credential file %v: %v", f.path, err)
+	}
+	if env.Version != 1 {
+		return nil, nil, fmt.Errorf("unsupported credential file version %d", env.Version)
+	}
+	if env.KDF != f.kdf {
+		return nil, nil, fmt.Errorf("credential file %v is encrypted with a %v, not a %v", f.path, kdfName(env.KDF), kdfName(f.kdf))
+	}
+	secret, err := f.secret()
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(f.kdf, secret, env.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, additionalData(env))
+	if err != nil {
+		return nil, nil, ErrWrongKey
+	}
+	if err := json.Unmarshal(plain, &tokens); err != nil {
+		return nil, nil, fmt.Errorf("invalid credential file %v: %v", f.path, err)
+	}
+	return tokens, secret, nil
+}
+
+// write encrypts the tokens with a new salt and nonce and replaces the file.
+func (f *File) write(tokens map[string]string, secret []byte) error {
+	if secret == nil {
+		var err error
+		if secret, err = f.secret(); err != nil {
+			return err
+		}
+	}
+	plain, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	env := envelope{Version: 1, KDF: f.kdf, Salt: make([]byte, 16)}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return err
+	}
+	aead, err := newAEAD(f.kdf, secret, env.Salt)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Data = aead.Seal(nil, env.Nonce, plain, additionalData(env))
+
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), ".credentials-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// newAEAD derives the AES-256 key from the secret and salt.
+func newAEAD(kdf string, secret, salt []byte) (cipher.AEAD, error) {
+	var key []byte
+	if kdf == kdfScrypt {
+		var err error
+		if key, err = scrypt.Key(secret, salt, scryptN, scryptR, scryptP, 32); err != nil {
+			return nil, err
+		}
+	} else {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(salt)
+		key = mac.Sum(nil)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds the header of the file to the encrypted data.
+func additionalData(env envelope) []byte {
+	return []byte(fmt.Sprintf("ring-bridge/v%d/%v", env.Version, env.KDF))
+}
+
+func kdfName(kdf string) string {
+	if kdf == kdfKeyFile {
+		return "key file"
+	}
+	return "passphrase"
+}
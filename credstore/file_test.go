@@ -0,0 +1,155 @@
+package credstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDir returns a temporary directory, the test removes it.
+func testDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "credstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func passphrase(value string) func() (string, error) {
+	return func() (string, error) { return value, nil }
+}
+
+func writeKeyFile(t *testing.T, path string, size int) string {
+	if err := ioutil.WriteFile(path, bytes.Repeat([]byte{7}, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		file func(dir string) *File
+	}{
+		{
+			name: "passphrase",
+			file: func(dir string) *File {
+				return NewPassphraseFile(filepath.Join(dir, "credentials.enc"), passphrase("correct horse"))
+			},
+		},
+		{
+			name: "key file",
+			file: func(dir string) *File {
+				return NewKeyFile(filepath.Join(dir, "credentials.enc"), writeKeyFile(t, filepath.Join(dir, "key"), minKeyFileSize))
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testDir(t)
+			defer os.RemoveAll(dir)
+			store := test.file(dir)
+
+			if _, err := store.Get("home"); err != ErrNotFound {
+				t.Fatalf("Get() of a missing file = %v, want ErrNotFound", err)
+			}
+			if err := store.Set("home", "token-home"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Set("cabin", "token-cabin"); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, "credentials.enc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(data, []byte("token-home")) {
+				t.Error("the file holds the token in plain text")
+			}
+
+			// A new File reads what the first one wrote.
+			reopened := test.file(dir)
+			for profile, want := range map[string]string{"home": "token-home", "cabin": "token-cabin"} {
+				if got, err := reopened.Get(profile); err != nil || got != want {
+					t.Errorf("Get(%q) = %q, %v, want %q", profile, got, err, want)
+				}
+			}
+			if err := reopened.Delete("home"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get("home"); err != ErrNotFound {
+				t.Errorf("Get() after Delete() = %v, want ErrNotFound", err)
+			}
+			if got, err := store.Get("cabin"); err != nil || got != "token-cabin" {
+				t.Errorf("Get(%q) = %q, %v, want %q", "cabin", got, err, "token-cabin")
+			}
+		})
+	}
+}
+
+func TestFileWrongSecret(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.enc")
+	if err := NewPassphraseFile(path, passphrase("correct horse")).Set("home", "token"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file *File
+	}{
+		{name: "wrong passphrase", file: NewPassphraseFile(path, passphrase("wrong horse"))},
+		{name: "key file instead of passphrase", file: NewKeyFile(path, writeKeyFile(t, filepath.Join(dir, "key"), minKeyFileSize))},
+		{name: "empty passphrase", file: NewPassphraseFile(path, passphrase(""))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if token, err := test.file.Get("home"); err == nil {
+				t.Errorf("Get() = %q, want an error", token)
+			}
+		})
+	}
+
+	if _, err := NewPassphraseFile(path, passphrase("wrong horse")).Get("home"); err != ErrWrongKey {
+		t.Errorf("Get() with the wrong passphrase = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestFileTampered(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.enc")
+	store := NewPassphraseFile(path, passphrase("correct horse"))
+	if err := store.Set("home", "token"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip a character of the base64 encrypted data.
+	index := bytes.Index(data, []byte(`"data": "`)) + len(`"data": "`)
+	if data[index] == 'A' {
+		data[index] = 'B'
+	} else {
+		data[index] = 'A'
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("home"); err != ErrWrongKey {
+		t.Errorf("Get() of a tampered file = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestKeyFileTooShort(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	store := NewKeyFile(filepath.Join(dir, "credentials.enc"), writeKeyFile(t, filepath.Join(dir, "key"), minKeyFileSize-1))
+	if err := store.Set("home", "token"); err == nil {
+		t.Error("Set() with a short key file succeeded")
+	}
+}
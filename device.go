@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// sendDeviceCommand answers device/{zid}/command. Unlocking a door lets
+// people in like disarming does, so lock.unlock needs the disarm code when
+// there is a disarm policy.
+func sendDeviceCommand(apiRequest public.Request, zID string, event *audit.Event) (events.APIGatewayProxyResponse, error) {
+	event.Detail = zID + " " + apiRequest.Command
+	if apiRequest.Command == bridge.CommandLockUnlock {
+		if response, ok := checkDisarm(apiRequest, event.Caller); !ok {
+			return response, nil
+		}
+	}
+	device, err := bridge.SendDeviceCommand(apiRequest.LocationID, apiRequest.AccessToken, zID, apiRequest.Command, apiRequest.Level)
+	var invalid *bridge.InvalidCommandError
+	if errors.As(err, &invalid) {
+		return sendResponse(public.ProcessError{Code: http.StatusBadRequest, Message: err.Error()})
+	}
+	if err != nil {
+		return ringError(err)
+	}
+	return sendResponse(public.DeviceCommandResponse{ID: device.ZID, Name: device.Name, Type: device.Type, Command: apiRequest.Command, Message: "Success"})
+}
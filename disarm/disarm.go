@@ -0,0 +1,227 @@
+// Package disarm checks the PIN or TOTP code a disarm request must carry.
+package disarm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Defaults of a policy without MaxAttempts or LockoutMinutes.
+const (
+	DefaultMaxAttempts    = 5
+	DefaultLockoutMinutes = 15
+)
+
+// Errors of a refused disarm.
+var (
+	ErrCodeRequired = errors.New("disarming needs a PIN or TOTP code")
+	ErrWrongCode    = errors.New("wrong PIN or TOTP code")
+)
+
+// ErrLocked is returned while disarming is locked after too many wrong codes.
+type ErrLocked struct {
+	Until time.Time
+}
+
+func (e *ErrLocked) Error() string {
+	return fmt.Sprintf("disarming is locked after too many wrong codes until %v", e.Until.Format(time.RFC3339))
+}
+
+// Policy is the layout of the disarm policy secret. A policy without a PIN
+// and TOTP secret lets every disarm through.
+type Policy struct {
+	PINHash        string `json:"pinHash,omitempty"`
+	TOTPSecret     string `json:"totpSecret,omitempty"`
+	MaxAttempts    int    `json:"maxAttempts,omitempty"`
+	LockoutMinutes int    `json:"lockoutMinutes,omitempty"`
+}
+
+// Enabled reports whether the policy needs a code.
+func (p Policy) Enabled() bool {
+	return p.PINHash != "" || p.TOTPSecret != ""
+}
+
+// SetPIN stores the bcrypt hash of the PIN.
+func (p *Policy) SetPIN(pin string) error {
+	if len(pin) < 4 {
+		return errors.New("the PIN must have at least 4 characters")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	p.PINHash = string(hash)
+	return nil
+}
+
+func (p Policy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (p Policy) lockout() time.Duration {
+	if p.LockoutMinutes > 0 {
+		return time.Duration(p.LockoutMinutes) * time.Minute
+	}
+	return DefaultLockoutMinutes * time.Minute
+}
+
+// LoadPolicy reads the policy from the backend. An empty secret is an empty policy.
+func LoadPolicy(backend secrets.Backend) (Policy, error) {
+	var policy Policy
+	value, err := backend.Get()
+	if err != nil {
+		return policy, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return policy, fmt.Errorf("invalid disarm policy in %v: %v", backend, err)
+	}
+	return policy, nil
+}
+
+// SavePolicy writes the policy to the backend.
+func SavePolicy(backend secrets.Backend, policy Policy) error {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.Put(string(data))
+}
+
+// Guard checks disarm codes against the policy of a backend and locks
+// disarming of a location after MaxAttempts wrong codes in a row.
+type Guard struct {
+	Backend secrets.Backend
+	// PolicyTTL is how long the policy is used before it is read again.
+	PolicyTTL time.Duration
+	// Attempts keeps the attempt counts, the locks and the used TOTP steps.
+	// With more than one Lambda instance it must be a cache.Shared store.
+	Attempts cache.Store
+
+	policy secrets.Reloader
+}
+
+// Check returns nil when the code may disarm the location.
+//
+// Every attempt is counted with cache.Increment before the code is checked,
+// so concurrent requests, even to other Lambda instances sharing Attempts,
+// can not try more than MaxAttempts codes before the location is locked.
+func (g *Guard) Check(locationID, code string) error {
+	policy, err := g.load()
+	if err != nil {
+		return err
+	}
+	if !policy.Enabled() {
+		return nil
+	}
+
+	lockKey := "disarm-lock:" + locationID
+	if until, locked := g.lockedUntil(lockKey); locked {
+		return &ErrLocked{Until: until}
+	}
+	if code == "" {
+		return ErrCodeRequired
+	}
+
+	attemptsKey := "disarm-attempts:" + locationID
+	count, err := cache.Increment(g.Attempts, attemptsKey, policy.lockout())
+	if err != nil {
+		return fmt.Errorf("unable to count the disarm attempt: %v", err)
+	}
+	now := time.Now()
+	if count <= int64(policy.maxAttempts()) && g.matches(policy, locationID, code, now) {
+		g.Attempts.Delete(attemptsKey)
+		return nil
+	}
+	if count < int64(policy.maxAttempts()) {
+		return ErrWrongCode
+	}
+	return g.lock(lockKey, now.Add(policy.lockout()), policy.lockout())
+}
+
+// lockedUntil returns the end of the lock of the key, if it is locked.
+func (g *Guard) lockedUntil(lockKey string) (time.Time, bool) {
+	data, found := g.Attempts.Get(lockKey)
+	if !found {
+		return time.Time{}, false
+	}
+	var until time.Time
+	if err := until.UnmarshalText(data); err != nil {
+		log.Printf("Ignoring unreadable disarm lock %v - %v", lockKey, err)
+		return time.Time{}, false
+	}
+	return until, time.Now().Before(until)
+}
+
+// lock locks the key until the time and returns the ErrLocked. When another
+// request locked it first that lock is kept.
+func (g *Guard) lock(lockKey string, until time.Time, lockout time.Duration) error {
+	data, _ := until.MarshalText()
+	added, err := cache.Add(g.Attempts, lockKey, data, lockout)
+	if err != nil {
+		log.Printf("Unable to store the disarm lock - %v", err)
+	}
+	if !added {
+		if existing, locked := g.lockedUntil(lockKey); locked {
+			until = existing
+		}
+	}
+	return &ErrLocked{Until: until}
+}
+
+// matches checks the code against the PIN and the TOTP secret. A TOTP code is
+// only accepted once.
+func (g *Guard) matches(policy Policy, locationID, code string, now time.Time) bool {
+	if policy.PINHash != "" && bcrypt.CompareHashAndPassword([]byte(policy.PINHash), []byte(code)) == nil {
+		return true
+	}
+	if policy.TOTPSecret == "" {
+		return false
+	}
+	step, ok := checkTOTP(policy.TOTPSecret, code, now)
+	if !ok {
+		return false
+	}
+	usedKey := "disarm-totp:" + locationID
+	if used, found := g.Attempts.Get(usedKey); found {
+		if last, err := strconv.ParseInt(string(used), 10, 64); err == nil && step <= last {
+			return false
+		}
+	}
+	// The step is claimed with Add, so two Lambda instances sharing Attempts
+	// can not both accept the same code.
+	claimed, err := cache.Add(g.Attempts, usedKey+":"+strconv.FormatInt(step, 10), []byte("used"), 3*totpStep)
+	if err != nil {
+		log.Printf("Unable to claim the TOTP code - %v", err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	g.Attempts.Set(usedKey, []byte(strconv.FormatInt(step, 10)), 3*totpStep)
+	return true
+}
+
+// load returns the policy, reading it again once PolicyTTL passed. The last
+// policy is kept when the backend fails.
+func (g *Guard) load() (Policy, error) {
+	policy, err := g.policy.Get(g.PolicyTTL, "disarm policy", func() (interface{}, error) { return LoadPolicy(g.Backend) })
+	if err != nil {
+		return Policy{}, err
+	}
+	return policy.(Policy), nil
+}
@@ -0,0 +1,227 @@
+package disarm
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+func newTestGuard(t *testing.T, policy Policy) *Guard {
+	backend := secrets.NewMemory("")
+	if err := SavePolicy(backend, policy); err != nil {
+		t.Fatal(err)
+	}
+	return &Guard{Backend: backend, PolicyTTL: time.Minute, Attempts: cache.NewMemoryStore()}
+}
+
+func pinPolicy(t *testing.T, pin string, maxAttempts int) Policy {
+	policy := Policy{MaxAttempts: maxAttempts, LockoutMinutes: 1}
+	if err := policy.SetPIN(pin); err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	code, err := totpCode(secret, time.Now().Unix()/int64(totpStep/time.Second)+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// wantLocked is the error of a locked location in the tests.
+var wantLocked = errors.New("locked")
+
+func checkErr(t *testing.T, step int, err, want error) {
+	t.Helper()
+	var locked *ErrLocked
+	switch {
+	case want == wantLocked:
+		if !errors.As(err, &locked) {
+			t.Fatalf("code %v: Check() = %v, want ErrLocked", step, err)
+		}
+	case err != want:
+		t.Fatalf("code %v: Check() = %v, want %v", step, err, want)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	tests := []struct {
+		name  string
+		codes []string
+		want  []error
+	}{
+		{
+			name:  "right PIN",
+			codes: []string{"1234"},
+			want:  []error{nil},
+		},
+		{
+			name:  "missing code does not count",
+			codes: []string{"", "", "", "1234"},
+			want:  []error{ErrCodeRequired, ErrCodeRequired, ErrCodeRequired, nil},
+		},
+		{
+			name:  "wrong codes below the limit",
+			codes: []string{"0000", "0000", "1234"},
+			want:  []error{ErrWrongCode, ErrWrongCode, nil},
+		},
+		{
+			name:  "locked at the limit",
+			codes: []string{"0000", "0000", "0000"},
+			want:  []error{ErrWrongCode, ErrWrongCode, wantLocked},
+		},
+		{
+			name:  "right PIN while locked",
+			codes: []string{"0000", "0000", "0000", "1234"},
+			want:  []error{ErrWrongCode, ErrWrongCode, wantLocked, wantLocked},
+		},
+		{
+			name:  "right PIN resets the count",
+			codes: []string{"0000", "0000", "1234", "0000", "0000", "1234"},
+			want:  []error{ErrWrongCode, ErrWrongCode, nil, ErrWrongCode, ErrWrongCode, nil},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard := newTestGuard(t, pinPolicy(t, "1234", 3))
+			for i, code := range test.codes {
+				checkErr(t, i, guard.Check("location", code), test.want[i])
+			}
+		})
+	}
+}
+
+func TestLockoutPerLocation(t *testing.T) {
+	guard := newTestGuard(t, pinPolicy(t, "1234", 2))
+	guard.Check("home", "0000")
+	checkErr(t, 0, guard.Check("home", "0000"), wantLocked)
+	checkErr(t, 1, guard.Check("cabin", "1234"), nil)
+}
+
+func TestLockoutExpires(t *testing.T) {
+	guard := newTestGuard(t, pinPolicy(t, "1234", 1))
+	checkErr(t, 0, guard.Check("location", "0000"), wantLocked)
+
+	// Move the lock into the past and drop the count, as if the lockout passed.
+	past, _ := time.Now().Add(-time.Second).MarshalText()
+	guard.Attempts.Set("disarm-lock:location", past, time.Minute)
+	guard.Attempts.Delete("disarm-attempts:location")
+	checkErr(t, 1, guard.Check("location", "1234"), nil)
+}
+
+func TestLockoutConcurrent(t *testing.T) {
+	// Several Lambda instances share the store but not the guard.
+	const maxAttempts, tries = 3, 20
+	guards := make([]*Guard, 4)
+	for i := range guards {
+		guards[i] = newTestGuard(t, pinPolicy(t, "1234", maxAttempts))
+		guards[i].Attempts = guards[0].Attempts
+	}
+
+	errs := make(chan error, tries)
+	var wg sync.WaitGroup
+	for i := 0; i < tries; i++ {
+		wg.Add(1)
+		go func(guard *Guard) {
+			defer wg.Done()
+			errs <- guard.Check("location", "0000")
+		}(guards[i%len(guards)])
+	}
+	wg.Wait()
+	close(errs)
+
+	var wrong, locked int
+	for err := range errs {
+		var lockedErr *ErrLocked
+		switch {
+		case err == ErrWrongCode:
+			wrong++
+		case errors.As(err, &lockedErr):
+			locked++
+		default:
+			t.Errorf("Check() = %v, want ErrWrongCode or ErrLocked", err)
+		}
+	}
+	if wrong != maxAttempts-1 || locked != tries-maxAttempts+1 {
+		t.Errorf("%v wrong and %v locked, want %v and %v", wrong, locked, maxAttempts-1, tries-maxAttempts+1)
+	}
+	checkErr(t, tries, guards[1].Check("location", "1234"), wantLocked)
+}
+
+func TestTOTPReplay(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		codes []string
+		want  []error
+	}{
+		{
+			name:  "current code",
+			codes: []string{currentCode(t, secret, 0)},
+			want:  []error{nil},
+		},
+		{
+			name:  "code of the previous step",
+			codes: []string{currentCode(t, secret, -1)},
+			want:  []error{nil},
+		},
+		{
+			name:  "code too old",
+			codes: []string{currentCode(t, secret, -3)},
+			want:  []error{ErrWrongCode},
+		},
+		{
+			name:  "same code again",
+			codes: []string{currentCode(t, secret, 0), currentCode(t, secret, 0)},
+			want:  []error{nil, ErrWrongCode},
+		},
+		{
+			name:  "older code after a newer one",
+			codes: []string{currentCode(t, secret, 0), currentCode(t, secret, -1)},
+			want:  []error{nil, ErrWrongCode},
+		},
+		{
+			name:  "newer code after an older one",
+			codes: []string{currentCode(t, secret, -1), currentCode(t, secret, 0)},
+			want:  []error{nil, nil},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard := newTestGuard(t, Policy{TOTPSecret: secret, MaxAttempts: 5})
+			for i, code := range test.codes {
+				checkErr(t, i, guard.Check("location", code), test.want[i])
+			}
+		})
+	}
+}
+
+func TestTOTPReplayAcrossGuards(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two Lambda instances share the store but not the guard.
+	first := newTestGuard(t, Policy{TOTPSecret: secret})
+	second := newTestGuard(t, Policy{TOTPSecret: secret})
+	second.Attempts = first.Attempts
+
+	code := currentCode(t, secret, 0)
+	checkErr(t, 0, first.Check("location", code), nil)
+	checkErr(t, 1, second.Check("location", code), ErrWrongCode)
+}
+
+func TestNoPolicy(t *testing.T) {
+	guard := newTestGuard(t, Policy{})
+	checkErr(t, 0, guard.Check("location", ""), nil)
+}
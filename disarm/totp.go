@@ -0,0 +1,63 @@
+package disarm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// totpStep is the time step of the codes, RFC 6238 and every authenticator app use 30 seconds.
+const totpStep = 30 * time.Second
+
+// totpDigits is the length of a code.
+const totpDigits = 6
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random base32 secret for an authenticator app.
+func NewTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURL returns the otpauth URL authenticator apps read from a QR code.
+func TOTPURL(secret, account string) string {
+	return fmt.Sprintf("otpauth://totp/%v?secret=%v&issuer=%v", url.PathEscape("Ring Bridge:"+account), secret, url.QueryEscape("Ring Bridge"))
+}
+
+// totpCode returns the code of the secret for the time step.
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// checkTOTP returns the time step the code matches, allowing one step of clock drift.
+func checkTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / int64(totpStep/time.Second)
+	for _, step := range []int64{current, current - 1, current + 1} {
+		expected, err := totpCode(secret, step)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
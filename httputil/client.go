@@ -0,0 +1,196 @@
+package httputil
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Trace logs the calls made to Ring and the messages exchanged with them. The
+// command line utility discards it unless -v is set, warnings go to the standard log.
+var Trace = log.New(os.Stderr, "", log.LstdFlags)
+
+// DefaultUserAgent identifies the bridge to Ring.
+const DefaultUserAgent = "smartthings-ringalarmv2/3.4.0 (+https://github.com/asishrs/smartthings-ringalarmv2)"
+
+// ClientConfig configures how the bridge connects to Ring over HTTP and websockets.
+type ClientConfig struct {
+	// Timeout limits a whole HTTP request and the websocket handshake.
+	Timeout time.Duration
+	// ProxyURL is the proxy for all calls. When empty the HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY environment variables are used.
+	ProxyURL string
+	// CAFile is a PEM file with extra certificate authorities to trust, e.g.
+	// the one of an intercepting proxy.
+	CAFile string
+	// UserAgent is sent with every request.
+	UserAgent string
+}
+
+// DefaultClientConfig returns the configuration used unless Configure is called.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{Timeout: 15 * time.Second, UserAgent: DefaultUserAgent}
+}
+
+// ClientConfigFromEnv returns the default configuration overridden by the
+// RING_HTTP_TIMEOUT, RING_HTTP_PROXY, RING_CA_FILE and RING_USER_AGENT environment variables.
+func ClientConfigFromEnv() (ClientConfig, error) {
+	config := DefaultClientConfig()
+	if value := os.Getenv("RING_HTTP_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid RING_HTTP_TIMEOUT %q: %v", value, err)
+		}
+		config.Timeout = timeout
+	}
+	if value := os.Getenv("RING_HTTP_PROXY"); value != "" {
+		config.ProxyURL = value
+	}
+	if value := os.Getenv("RING_CA_FILE"); value != "" {
+		config.CAFile = value
+	}
+	if value := os.Getenv("RING_USER_AGENT"); value != "" {
+		config.UserAgent = value
+	}
+	return config, nil
+}
+
+// Proxy returns the proxy function for the configuration.
+func (c ClientConfig) Proxy() (func(*http.Request) (*url.URL, error), error) {
+	if c.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q", c.ProxyURL)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// TLSConfig returns the TLS configuration trusting the system and the extra certificate authorities.
+func (c ClientConfig) TLSConfig() (*tls.Config, error) {
+	if c.CAFile == "" {
+		return nil, nil
+	}
+	pem, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", c.CAFile)
+	}
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+var userAgent = DefaultUserAgent
+
+// Configure applies the configuration to Client.
+func Configure(config ClientConfig) error {
+	proxy, err := config.Proxy()
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return err
+	}
+	Client.Timeout = config.Timeout
+	Client.Transport = newTransport(proxy, tlsConfig)
+	userAgent = config.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return nil
+}
+
+func newTransport(proxy func(*http.Request) (*url.URL, error), tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          10,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// do sends the request with the bridge User-Agent and returns the decoded response body.
+// Server errors, 429 and the refusals 401, 403 and 404 are returned as a *StatusError.
+// Go only decompresses gzip it asked for itself, so a compressed body Ring
+// sends anyway is decoded here.
+func do(req *http.Request) ([]byte, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	res, err := Client.Do(req)
+	if err != nil {
+		Trace.Println(err)
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+		err := &StatusError{URL: req.URL.String(), StatusCode: res.StatusCode}
+		Trace.Println(err)
+		return nil, err
+	}
+	body, err := decodeBody(res.Header.Get("Content-Encoding"), res.Body)
+	if err != nil {
+		Trace.Println(err)
+		return nil, err
+	}
+	defer body.Close()
+	responseBody, err := ioutil.ReadAll(body)
+	if err != nil {
+		Trace.Println(err)
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		// The body is returned as well, the OAuth answers explain the refusal in it.
+		err := &StatusError{URL: req.URL.String(), StatusCode: res.StatusCode}
+		Trace.Println(err)
+		return responseBody, err
+	}
+	return responseBody, nil
+}
+
+func decodeBody(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return ioutil.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// deflate is meant to be zlib wrapped, but some servers send raw deflate.
+		buffered := bufio.NewReader(body)
+		header, err := buffered.Peek(2)
+		if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
@@ -3,8 +3,8 @@ package httputil
 import (
 	"bytes"
 	"encoding/json"
-	"io/ioutil"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -153,6 +153,8 @@ type RingDeviceInfo struct {
 	SessionID int64   `json:"sessionId"`
 	Status    int     `json:"status"`
 	Context   Context `json:"context"`
+	// Raw is the message as received, for readers that need to know which fields Ring sent.
+	Raw json.RawMessage `json:"-"`
 }
 
 // History represents Ring Device History Event
@@ -198,6 +200,44 @@ type UserLocations struct {
 	Location []UserLocation `json:"user_locations"`
 }
 
+// StatusError is returned when Ring answers with a server error, asks to slow
+// down or refuses the token or the resource.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v returned %d %v", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Permanent reports whether Ring refused the request, so retrying it can not
+// help. The retry package does not retry such an error nor count it against Ring.
+func (e *StatusError) Permanent() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusNotFound
+}
+
+// ErrNoLocation is returned when the Ring account has no location.
+var ErrNoLocation error = noLocationError{}
+
+type noLocationError struct{}
+
+func (noLocationError) Error() string   { return "no location found for the Ring account" }
+func (noLocationError) Permanent() bool { return true }
+
+// refused reports whether err is a refusal with an OAuth answer in the body.
+func refused(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Permanent()
+}
+
+// Client is the HTTP client used for every call to the Ring API. It can be
+// replaced or have its Transport wrapped, e.g. to record or replay traffic.
+var Client = &http.Client{
+	Timeout:   DefaultClientConfig().Timeout,
+	Transport: newTransport(http.ProxyFromEnvironment, nil),
+}
+
 // AuthRequest initiates the call to Ring to submit authentication request.
 func AuthRequest(url string, oauthRequest OAuthRequest, code string) (OAuthResponse, error) {
 	// log.Printf("OAuthRequest Data: %v", oauthRequest)
@@ -211,12 +251,15 @@ func AuthRequest(url string, oauthRequest OAuthRequest, code string) (OAuthRespo
 
 	requestByte, _ := json.Marshal(oauthRequest)
 	responseBody, err := post(url, headers, requestByte)
-	if err != nil {
+	if err != nil && !refused(err) {
 		return OAuthResponse{}, err
 	}
 
 	var oauthResponse OAuthResponse
 	json.Unmarshal(responseBody, &oauthResponse)
+	if err != nil && oauthResponse.Error == "" {
+		return OAuthResponse{}, err
+	}
 	// log.Println("Temp Token " + oauthResponse.AccessToken)
 	return oauthResponse, nil
 }
@@ -226,19 +269,22 @@ func AuthRequestWithRefreshToken(url string, oauthRequest OAuthRequestWithRefres
 	// log.Printf("OAuthRequestWithRefreshToken Data: %v", oauthRequest)
 	requestByte, err := json.Marshal(oauthRequest)
 	if err != nil {
-		log.Println("Error while trying to get AccessToken using Refresh Token")
+		Trace.Println("Error while trying to get AccessToken using Refresh Token")
 		return OAuthResponse{}, err
 	}
 
 	responseBody, err := post(url, nil, requestByte)
-	if err != nil {
-		log.Println("Error while trying to get AccessToken using Refresh Token")
+	if err != nil && !refused(err) {
+		Trace.Println("Error while trying to get AccessToken using Refresh Token")
 		return OAuthResponse{}, err
 	}
 	// log.Printf("AuthRequestWithRefreshToken response - %v\n", string(responseBody))
 
 	var oauthResponse OAuthResponse
 	json.Unmarshal(responseBody, &oauthResponse)
+	if err != nil && oauthResponse.Error == "" {
+		return OAuthResponse{}, err
+	}
 
 	// log.Println("Temp Token " + oauthResponse.AccessToken)
 	return oauthResponse, nil
@@ -268,36 +314,43 @@ func LocationRequest(url string, accessToken string) (UserLocation, error) {
 
 	responseBody, err := get(url, headers, nil)
 	if err != nil {
-		log.Println("Error while trying to make Ring Location Request")
+		Trace.Println("Error while trying to make Ring Location Request")
 		return UserLocation{}, err
 	}
 	//log.Printf("Location response - %v\n", string(responseBody))
 	var userLocations UserLocations
 	json.Unmarshal(responseBody, &userLocations)
+	if len(userLocations.Location) == 0 {
+		return UserLocation{}, ErrNoLocation
+	}
 	// log.Println("Location " + userLocations.Location[0].LocationID)
 	return userLocations.Location[0], nil
 }
 
 // HistoryRequest finds all the events for Ring Devices
 func HistoryRequest(url string, accessToken string, locationID string, limit string) ([]History, error) {
+	return HistoryPageRequest(url, accessToken, locationID, "0", limit)
+}
+
+// HistoryPageRequest finds the events for Ring Devices, skipping the offset newest events.
+func HistoryPageRequest(url string, accessToken string, locationID string, offset string, limit string) ([]History, error) {
 	headers := map[string]string{
 		"Authorization":   "Bearer " + accessToken,
 		"Accept":          "application/json",
-		"Accept-Encoding": "gzip, deflate, br",
 		"Accept-Language": "en-US,en;q=0.9",
 	}
 
 	params := map[string]string{
 		"accountId": locationID,
-		"offset":    "0",
+		"offset":    offset,
 		"limit":     limit,
 		"maxLevel":  "50",
 	}
 
 	responseBody, err := get(url, headers, params)
-	log.Printf("History response body - %v\n", string(responseBody))
+	Trace.Printf("History response body - %v\n", string(responseBody))
 	if err != nil {
-		log.Println("Error while trying to get the History Event")
+		Trace.Println("Error while trying to get the History Event")
 		return nil, err
 	}
 	var history []History
@@ -314,20 +367,20 @@ func ConnectionRequest(url string, locationID string, accessToken string) (RingW
 
 	responseBody, err := post(url, headers, []byte("accountId="+locationID))
 	if err != nil {
-		log.Println("Error while trying to access get Ring WS Connection Details")
+		Trace.Println("Error while trying to access get Ring WS Connection Details")
 		return RingWSConnection{}, err
 	}
 	// log.Printf("ConnectionRequest Respose - %v\n", string(responseBody))
 	var connection RingWSConnection
 	json.Unmarshal(responseBody, &connection)
-	log.Println("Connection [" + connection.Server + ", " + connection.AuthCode + "]")
+	Trace.Println("Connection [" + connection.Server + ", " + connection.AuthCode + "]")
 	return connection, nil
 }
 
 func get(url string, headers map[string]string, params map[string]string) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		log.Println(err)
+		Trace.Println(err)
 		return nil, err
 	}
 	for name, value := range headers {
@@ -340,41 +393,19 @@ func get(url string, headers map[string]string, params map[string]string) ([]byt
 	}
 	req.URL.RawQuery = query.Encode()
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	defer res.Body.Close()
-	responseBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	return responseBody, nil
+	return do(req)
 }
 
 func post(url string, headers map[string]string, requestBody []byte) ([]byte, error) {
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
-		log.Println(err)
+		Trace.Println(err)
 		return nil, err
 	}
 	for name, value := range headers {
 		req.Header.Add(name, value)
 	}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
-	defer res.Body.Close()
-	responseBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		log.Println(err)
-		return nil, err
-	}
 	// log.Printf("Url - %v, Header - %v", url, headers)
-	return responseBody, nil
+	return do(req)
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// idempotencyTTL is how long the result of a mode change is returned again for its idempotency key.
+var idempotencyTTL = 10 * time.Minute
+
+// idempotentResult is the cached response of a mode change.
+type idempotentResult struct {
+	Action     string `json:"action"`
+	LocationID string `json:"locationId"`
+	StatusCode int    `json:"statusCode"`
+	Body       string `json:"body"`
+	// Pending is set while the first request with the key runs.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// idempotent runs the mode change once per idempotency key, taken from the
+// Idempotency-Key header or the idempotencyKey of the body. The key is claimed
+// in stateCache before the change runs, so a concurrent request with the same
+// key gets 409 and a later one the cached response. A key reused for another
+// action or location gets 422. Only successful changes are kept, the claim of
+// a failed one is removed so it can be retried.
+func idempotent(request events.APIGatewayProxyRequest, apiRequest public.Request, action string, caller audit.Caller, run func() (events.APIGatewayProxyResponse, error)) (events.APIGatewayProxyResponse, error) {
+	key := header(request.Headers, "Idempotency-Key")
+	if key == "" {
+		key = apiRequest.IdempotencyKey
+	}
+	if key == "" {
+		return run()
+	}
+	if !sharedState() {
+		log.Printf("Refusing idempotency key %v, the Lambda needs RING_CACHE=dynamodb:<table> for them", key)
+		return sendResponse(public.ProcessError{Code: http.StatusNotImplemented, Message: "idempotency keys need RING_CACHE=dynamodb:<table>"})
+	}
+
+	// Keys are per API key, so callers can not read each other's results.
+	cacheKey := "idempotency:" + caller.KeyID + ":" + key
+	pending, _ := json.Marshal(idempotentResult{Action: action, LocationID: apiRequest.LocationID, Pending: true})
+	claimed, err := cache.Add(stateCache, cacheKey, pending, idempotencyTTL)
+	if err != nil {
+		log.Printf("Unable to claim idempotency key %v - %v", key, err)
+		return sendResponse(public.ProcessError{Code: http.StatusServiceUnavailable, Message: http.StatusText(http.StatusServiceUnavailable)})
+	}
+	if !claimed {
+		var cached idempotentResult
+		if !cache.GetJSON(stateCache, cacheKey, &cached) || cached.Pending {
+			log.Printf("Idempotency key %v is in use by a running request", key)
+			return clientError(http.StatusConflict)
+		}
+		if cached.Action != action || cached.LocationID != apiRequest.LocationID {
+			log.Printf("Idempotency key %v was used for %v of location %v", key, cached.Action, cached.LocationID)
+			return clientError(http.StatusUnprocessableEntity)
+		}
+		log.Printf("Returning the cached result of idempotency key %v", key)
+		return events.APIGatewayProxyResponse{
+			StatusCode: cached.StatusCode,
+			Headers:    map[string]string{"Idempotent-Replayed": "true"},
+			Body:       cached.Body,
+		}, nil
+	}
+
+	response, err := run()
+	if result, _ := auditResult(response); err == nil && result == audit.ResultSuccess {
+		cache.SetJSON(stateCache, cacheKey, idempotentResult{Action: action, LocationID: apiRequest.LocationID, StatusCode: response.StatusCode, Body: response.Body}, idempotencyTTL)
+	} else {
+		stateCache.Delete(cacheKey)
+	}
+	return response, err
+}
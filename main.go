@@ -3,22 +3,26 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/asishrs/smartthings-ringalarmv2/apikey"
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
 	"github.com/asishrs/smartthings-ringalarmv2/cmd"
 	"github.com/asishrs/smartthings-ringalarmv2/httputil"
 	"github.com/asishrs/smartthings-ringalarmv2/public"
+	"github.com/asishrs/smartthings-ringalarmv2/retry"
 	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-var errorAccessDenied = errors.New("access_denied")
-
 func clientError(status int) (events.APIGatewayProxyResponse, error) {
 	return events.APIGatewayProxyResponse{
 		StatusCode: status,
@@ -28,154 +32,143 @@ func clientError(status int) (events.APIGatewayProxyResponse, error) {
 
 func getAccessToken(apiRequest public.Request) (string, string, error) {
 	if apiRequest.RefreshToken != "" {
-		log.Println("Using Refresh Token to Authenticate Ring API")
-		oauthResponse, err := httputil.AuthRequestWithRefreshToken("https://oauth.ring.com/oauth/token", httputil.OAuthRequestWithRefreshToken{"ring_official_ios", "refresh_token", apiRequest.RefreshToken})
-		if err != nil {
-			return "", apiRequest.RefreshToken, err
-		}
-		if oauthResponse.Error == "access_denied" {
-			return oauthResponse.AccessToken, oauthResponse.RefreshToken, errorAccessDenied
-		}
-		return oauthResponse.AccessToken, oauthResponse.RefreshToken, nil
-	} else {
-		log.Println("Using User Name & Password to Authenticate Ring API")
-		oauthResponse, _ := httputil.AuthRequest("https://oauth.ring.com/oauth/token", httputil.OAuthRequest{"ring_official_ios", "password", apiRequest.Password, "client", apiRequest.User}, "")
-		return oauthResponse.AccessToken, "", nil
-	}
-}
-
-func getLocation(apiRequest public.Request, accessToken string) (httputil.UserLocation, error) {
-	location, err := httputil.LocationRequest("https://api.ring.com/devices/v1/locations", accessToken)
-	if err != nil {
-		return httputil.UserLocation{}, err
+		return bridge.AccessToken(apiRequest.RefreshToken)
 	}
-
-	return location, nil
+	accessToken, _ := bridge.PasswordAccessToken(apiRequest.User, apiRequest.Password)
+	return accessToken, "", nil
 }
 
-func getZID(apiRequest public.Request, accessToken, locationID string) (string, error) {
-	// log.Println("Reading the ZID")
-	zID := apiRequest.ZID
-	if len(zID) == 0 {
-		ringDeviceInfo, err := getDevices(locationID, accessToken)
+// getStatus answers status. The response carries an ETag of the status and of
+// since, the history limit and withHistory; a request with a matching
+// If-None-Match gets 304 without a body. With since only the devices
+// and events after it are returned.
+func getStatus(request events.APIGatewayProxyRequest, apiRequest public.Request, withHistory bool) (events.APIGatewayProxyResponse, error) {
+	since := apiRequest.Since
+	if value, ok := request.QueryStringParameters["since"]; ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			log.Println(err)
-			return "", err
-		}
-		for i := range ringDeviceInfo.Body {
-			if ringDeviceInfo.Body[i].General.V2.DeviceType == "access-code" {
-				zID = ringDeviceInfo.Body[i].General.V2.AdapterZID
-			}
+			return clientError(http.StatusBadRequest)
 		}
+		since = parsed
 	}
-	return zID, nil
-}
 
-func getDevices(locationID string, accessToken string) (*httputil.RingDeviceInfo, error) {
-	connection, err := httputil.ConnectionRequest("https://app.ring.com/api/v1/rs/connections", locationID, accessToken)
+	status, err := bridge.Status(apiRequest.LocationID, apiRequest.AccessToken, apiRequest.HistoryLimit)
 	if err != nil {
-		return nil, err
+		return ringError(err)
 	}
-	return wsutil.ActiveDevices(connection)
-}
-
-func makeTimestamp() int64 {
-	return time.Now().UnixNano() / (int64(time.Millisecond) / int64(time.Nanosecond))
+	etag := bridge.ETag(status, fmt.Sprintf("since=%v&limit=%v&history=%v", since, apiRequest.HistoryLimit, withHistory))
+	if etagMatches(header(request.Headers, "If-None-Match"), etag) {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusNotModified, Headers: map[string]string{"ETag": etag}}, nil
+	}
+	if since > 0 {
+		status = bridge.Delta(status, since)
+	}
+	if !withHistory && len(status.Events) > 0 {
+		// Only keep the refresh event, the history needs the history:read scope.
+		status.Events = status.Events[:1]
+	}
+	response, err := sendResponse(status)
+	response.Headers = map[string]string{"ETag": etag}
+	return response, err
 }
 
-func getStatus(apiRequest public.Request) (events.APIGatewayProxyResponse, error) {
-	log.Printf("LocationID %v", apiRequest.LocationID)
-
-	var ringEvents []public.RingDeviceEvent
-	history, err := httputil.HistoryRequest("https://app.ring.com/api/v1/rs/history", apiRequest.AccessToken, apiRequest.LocationID, strconv.Itoa(apiRequest.HistoryLimit))
-	if err != nil {
-		log.Println("Error while trying to get Ring devices History.")
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+// etagMatches reports whether the If-None-Match header lists the ETag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
 	}
+	return false
+}
 
-	// Adding Refresh time Event
-	ringEvents = append(ringEvents, public.RingDeviceEvent{"Ring Alarm", makeTimestamp(), "Refresh"})
+// waitMaxTimeout caps the wait of status/wait, below the 29 seconds API Gateway allows.
+var waitMaxTimeout = 25 * time.Second
 
-	for i := range history {
-		//result, _ := json.Marshal(history[i])
-		//log.Printf("Histoy - %v", string(result))
-		//log.Printf("Device: %s, Time : %v, Type: %s\n", history[i].Context.AffectedEntityName, time.Unix(0, history[i].Context.EventOccurredTsMs*int64(time.Millisecond)), history[i].Body[0].Impulse.ImpulseTypes[0].ImpulseType)
-		val := history[i].Body[0].General.V2.AdapterType
-		if history[i].Body[0].Impulse.ImpulseTypes != nil {
-			val = history[i].Body[0].Impulse.ImpulseTypes[0].ImpulseType
-		}
-		ringEvents = append(ringEvents, public.RingDeviceEvent{history[i].Context.AffectedEntityName, history[i].Context.EventOccurredTsMs, val})
+// getWaitStatus answers status/wait, the status once it changed or the timeout of the request passed.
+func getWaitStatus(apiRequest public.Request, withHistory bool) (events.APIGatewayProxyResponse, error) {
+	timeout := time.Duration(apiRequest.Timeout) * time.Second
+	if timeout <= 0 || timeout > waitMaxTimeout {
+		timeout = waitMaxTimeout
 	}
-
-	var deviceStatus []public.RingDeviceStatus
-	ringDeviceInfo, err := getDevices(apiRequest.LocationID, apiRequest.AccessToken)
+	status, err := bridge.WaitStatus(apiRequest.LocationID, apiRequest.AccessToken, apiRequest.HistoryLimit, apiRequest.Version, apiRequest.Since, timeout)
 	if err != nil {
-		log.Println("Error while trying to get Ring Devices.")
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+		return ringError(err)
 	}
-
-	for i := range ringDeviceInfo.Body {
-		// log.Printf("RDName: %s, Type: %s, Fault: %v, Mode: %s\n", ringDeviceInfo.Body[i].General.V2.Name, ringDeviceInfo.Body[i].General.V2.DeviceType, ringDeviceInfo.Body[i].Device.V1.Faulted, ringDeviceInfo.Body[i].Device.V1.Mode)
-		deviceStatus = append(deviceStatus, public.RingDeviceStatus{ringDeviceInfo.Body[i].General.V2.ZID, ringDeviceInfo.Body[i].General.V2.Name, ringDeviceInfo.Body[i].General.V2.DeviceType, ringDeviceInfo.Body[i].Device.V1.Faulted, ringDeviceInfo.Body[i].Device.V1.Mode})
+	if !withHistory && len(status.Events) > 0 {
+		status.Events = status.Events[:1]
 	}
-
-	// for i := range deviceStatus {
-	// 	log.Printf("DName: %s, Type: %s, Fault: %v, Mode: %s\n", deviceStatus[i].Name, deviceStatus[i].Type, deviceStatus[i].Faulted, deviceStatus[i].Mode)
-	// }
-
-	return sendResponse(public.DeviceResponse{deviceStatus, ringEvents})
+	return sendResponse(status)
 }
 
-func setStatus(apiRequest public.Request, status string) (events.APIGatewayProxyResponse, error) {
-	zID, err := getZID(apiRequest, apiRequest.AccessToken, apiRequest.LocationID)
-	if err != nil {
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+func setStatus(apiRequest public.Request, status string, caller audit.Caller) (events.APIGatewayProxyResponse, error) {
+	if status == bridge.Modes["off"] {
+		if response, ok := checkDisarm(apiRequest, caller); !ok {
+			return response, nil
+		}
 	}
-
-	connection, err := httputil.ConnectionRequest("https://app.ring.com/api/v1/rs/connections", apiRequest.LocationID, apiRequest.AccessToken)
+	changed, err := bridge.SetMode(apiRequest.LocationID, apiRequest.AccessToken, apiRequest.ZID, status)
 	if err != nil {
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+		return ringError(err)
 	}
-
-	_, err = wsutil.Status(zID, status, connection)
-	if err != nil {
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+	if !changed {
+		return sendResponse(public.ModeChangeResponse{Message: "No change"})
 	}
 
-	return sendResponse(public.ModeChangeResponse{"Success"})
+	return sendResponse(public.ModeChangeResponse{Message: "Success"})
 }
 
 func getMetaData(apiRequest public.Request) (events.APIGatewayProxyResponse, error) {
-	location, err := getLocation(apiRequest, apiRequest.AccessToken)
+	location, err := bridge.Location(apiRequest.AccessToken)
 	if err != nil {
 		log.Println("Error while trying to get Ring Location Id.")
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+		return ringError(err)
 	}
 
-	zID, err := getZID(apiRequest, apiRequest.AccessToken, location.ID)
+	ring := bridge.NewSession(location.ID, apiRequest.AccessToken)
+	defer ring.Close()
+	zID, err := ring.ZID(apiRequest.ZID)
 	if err != nil {
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+		return ringError(err)
 	}
-	return sendResponse(public.RingMetaDataResponse{public.Location{location.ID, location.Name,
-		public.Address{location.Address.Line1, location.Address.City, location.Address.State, location.Address.ZipCode}}, zID})
+	return sendResponse(public.RingMetaDataResponse{Location: publicLocation(location), ZID: zID})
 }
 
 func getRawDevices(apiRequest public.Request) (events.APIGatewayProxyResponse, error) {
-	location, err := getLocation(apiRequest, apiRequest.AccessToken)
+	location, err := bridge.Location(apiRequest.AccessToken)
 	if err != nil {
 		log.Println("Error while trying to get Ring Location Id.")
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+		return ringError(err)
 	}
 	log.Printf("Location ID %v", location.ID)
 
-	devices, err := getDevices(location.ID, apiRequest.AccessToken)
+	devices, err := bridge.Devices(location.ID, apiRequest.AccessToken)
 	if err != nil {
-		return sendResponse(public.ProcessError{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)})
+		return ringError(err)
 	}
 	log.Printf("Raw Device \n%v", devices)
 
-	return sendResponse(public.RingDevices{public.Location{location.ID, location.Name,
-		public.Address{location.Address.Line1, location.Address.City, location.Address.State, location.Address.ZipCode}}, devices})
+	return sendResponse(public.RingDevices{Location: publicLocation(location), Devices: devices})
+}
+
+func publicLocation(location httputil.UserLocation) public.Location {
+	return public.Location{ID: location.ID, Name: location.Name,
+		Address: public.Address{Street: location.Address.Line1, City: location.Address.City, State: location.Address.State, ZipCode: location.Address.ZipCode}}
+}
+
+// ringError reports a failed Ring call. When the circuit breaker is open the
+// response says Ring is unavailable, and 409 says another change of the
+// location is running, instead of a generic error.
+func ringError(err error) (events.APIGatewayProxyResponse, error) {
+	var open *retry.ErrOpen
+	if errors.As(err, &open) {
+		return sendResponse(public.ProcessError{Code: http.StatusServiceUnavailable, Message: open.Error()})
+	}
+	if err == bridge.ErrLocationBusy {
+		return sendResponse(public.ProcessError{Code: http.StatusConflict, Message: err.Error()})
+	}
+	return sendResponse(public.ProcessError{Code: http.StatusInternalServerError, Message: http.StatusText(http.StatusInternalServerError)})
 }
 
 func sendResponse(data interface{}) (events.APIGatewayProxyResponse, error) {
@@ -187,29 +180,80 @@ func sendResponse(data interface{}) (events.APIGatewayProxyResponse, error) {
 	}, nil
 }
 
+// auditedActions are written to the audit log.
+var auditedActions = map[string]bool{"home": true, "away": true, "off": true, "codes/add": true, "codes/update": true, "codes/remove": true, "device/command": true}
+
 // Handler is your Lambda function handler
 // It uses Amazon API Gateway request/responses provided by the aws-lambda-go/events package,
 // However you could use other event sources (S3, Kinesis etc), or JSON-decoded primitive types such as 'string'.
 func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	log.Println("Ring Alarm - Version 3.4.0")
+	action, zID := splitAction(request.PathParameters["ring-action"])
+	event := audit.Event{Caller: audit.Caller{SourceIP: request.RequestContext.Identity.SourceIP}, Action: action}
+	start := time.Now()
+	response, err := handle(request, action, zID, &event)
+	if auditedActions[action] {
+		event.LatencyMs = time.Since(start).Milliseconds()
+		var detail string
+		event.Result, detail = auditResult(response)
+		if detail != "" {
+			event.Detail = strings.TrimSpace(event.Detail + " " + detail)
+		}
+		audit.Record(event)
+	}
+	return response, err
+}
+
+// splitAction turns the device/{zid}/command path into the device/command
+// action and the zid, other actions have no zid.
+func splitAction(path string) (string, string) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 3 && parts[0] == "device" && parts[1] != "" && parts[2] == "command" {
+		return "device/command", parts[1]
+	}
+	return path, ""
+}
+
+// handle runs the action, filling in the caller and location of the audit event.
+func handle(request events.APIGatewayProxyRequest, action, zID string, event *audit.Event) (events.APIGatewayProxyResponse, error) {
+	if response, ok := verifySignature(request); !ok {
+		return response, nil
+	}
+	key, response, ok := authorize(request, action)
+	event.KeyID, event.KeyName = key.ID, key.Name
+	if !ok {
+		return response, nil
+	}
 	var apiRequest public.Request
 	err := json.Unmarshal([]byte(request.Body), &apiRequest)
 	if err != nil {
 		return clientError(http.StatusUnprocessableEntity)
 	}
 
-	pathParams := request.PathParameters
-	action := pathParams["ring-action"]
 	log.Printf("Requested Action - %v\n", action)
+	if action == "audit" {
+		return getAudit(apiRequest)
+	}
+	if err := authenticate(&apiRequest); err != nil {
+		log.Printf("Unable to authenticate - %v", err)
+		return ringError(err)
+	}
+	event.LocationID = apiRequest.LocationID
 	switch action {
 	case "status":
-		return getStatus(apiRequest)
-	case "home":
-		return setStatus(apiRequest, "some")
-	case "away":
-		return setStatus(apiRequest, "all")
-	case "off":
-		return setStatus(apiRequest, "none")
+		return getStatus(request, apiRequest, apiKeys == nil || key.Allows(apikey.ScopeHistoryRead))
+	case "status/wait":
+		return getWaitStatus(apiRequest, apiKeys == nil || key.Allows(apikey.ScopeHistoryRead))
+	case "home", "away", "off":
+		return idempotent(request, apiRequest, action, event.Caller, func() (events.APIGatewayProxyResponse, error) {
+			return setStatus(apiRequest, bridge.Modes[action], event.Caller)
+		})
+	case "codes":
+		return getAccessCodes(apiRequest)
+	case "codes/add", "codes/update", "codes/remove":
+		return changeAccessCode(apiRequest, action, event)
+	case "device/command":
+		return sendDeviceCommand(apiRequest, zID, event)
 	case "meta":
 		return getMetaData(apiRequest)
 	case "devices":
@@ -219,11 +263,129 @@ func Handler(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRespo
 	}
 }
 
+// auditResult reads the result of the action from the response.
+func auditResult(response events.APIGatewayProxyResponse) (string, string) {
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return audit.ResultDenied, http.StatusText(response.StatusCode)
+	case http.StatusLocked:
+		return audit.ResultLocked, http.StatusText(response.StatusCode)
+	default:
+		return audit.ResultFailure, http.StatusText(response.StatusCode)
+	}
+	var processError public.ProcessError
+	if json.Unmarshal([]byte(response.Body), &processError) == nil && processError.Code != 0 {
+		return audit.ResultFailure, processError.Message
+	}
+	return audit.ResultSuccess, ""
+}
+
+// getAudit returns the audit events of the time range, newest first.
+func getAudit(apiRequest public.Request) (events.APIGatewayProxyResponse, error) {
+	filter := audit.Filter{Action: apiRequest.AuditAction, Limit: apiRequest.Limit}
+	for _, t := range []struct {
+		value string
+		into  *time.Time
+	}{{apiRequest.From, &filter.From}, {apiRequest.To, &filter.To}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return sendResponse(public.ProcessError{Code: http.StatusBadRequest, Message: "from and to must be RFC 3339 times"})
+		}
+		*t.into = parsed
+	}
+	events, err := audit.Default.Query(filter)
+	if err == audit.ErrNotQueryable {
+		return sendResponse(public.ProcessError{Code: http.StatusNotImplemented, Message: err.Error()})
+	}
+	if err != nil {
+		log.Printf("Unable to query the audit log - %v", err)
+		return sendResponse(public.ProcessError{Code: http.StatusInternalServerError, Message: http.StatusText(http.StatusInternalServerError)})
+	}
+	return sendResponse(public.AuditResponse{Events: events})
+}
+
+// configureClients sets up the HTTP client and websocket dialer from the environment.
+func configureClients() error {
+	config, err := httputil.ClientConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := httputil.Configure(config); err != nil {
+		return err
+	}
+	return wsutil.Configure(config)
+}
+
 func main() {
 	args := os.Args[1:]
 	if len(args) > 0 {
+		cmd.Handler = Handler
+		cmd.ConfigureServer = configureServer
+		cmd.Authorize = authorizeStream
 		cmd.Execute()
 	} else {
-		lambda.Start(Handler)
+		requireSharedState = true
+		if err := configureClients(); err != nil {
+			log.Printf("Invalid HTTP client configuration, using the defaults - %v", err)
+		}
+		if err := configureSecrets(); err != nil {
+			log.Printf("Invalid RING_SECRET_BACKEND, requests must send their own credentials - %v", err)
+		}
+		window, err := durationFromEnv("RING_SIGNATURE_WINDOW", 5*time.Minute)
+		if err == nil {
+			var keysTTL time.Duration
+			if keysTTL, err = durationFromEnv("RING_SIGNING_KEYS_TTL", time.Minute); err == nil {
+				err = configureSigning(os.Getenv("RING_SIGNING_KEYS"), window, keysTTL)
+			}
+		}
+		if err != nil {
+			log.Printf("Invalid request signing configuration, refusing all requests - %v", err)
+			configErr = err
+		}
+		keysTTL, err := durationFromEnv("RING_API_KEYS_TTL", time.Minute)
+		if err == nil {
+			err = configureAPIKeys(os.Getenv("RING_API_KEYS"), keysTTL)
+		}
+		if err != nil {
+			log.Printf("Invalid API key configuration, refusing all requests - %v", err)
+			configErr = err
+		}
+		if idempotencyTTL, err = durationFromEnv("RING_IDEMPOTENCY_TTL", idempotencyTTL); err != nil {
+			log.Printf("Invalid RING_IDEMPOTENCY_TTL, using 10m - %v", err)
+			idempotencyTTL = 10 * time.Minute
+		}
+		if waitMaxTimeout, err = durationFromEnv("RING_WAIT_MAX_TIMEOUT", waitMaxTimeout); err != nil {
+			log.Printf("Invalid RING_WAIT_MAX_TIMEOUT, using 25s - %v", err)
+			waitMaxTimeout = 25 * time.Second
+		}
+		if err := configureAudit(os.Getenv("RING_AUDIT_LOG")); err != nil {
+			log.Printf("Invalid RING_AUDIT_LOG, writing the audit events to the log - %v", err)
+		}
+		policyTTL, err := durationFromEnv("RING_DISARM_POLICY_TTL", time.Minute)
+		if err == nil {
+			err = configureDisarm(os.Getenv("RING_DISARM_POLICY"), policyTTL)
+		}
+		if err != nil {
+			log.Printf("Invalid disarm policy configuration, refusing all requests - %v", err)
+			configErr = err
+		}
+		if !sharedState() {
+			log.Printf("RING_CACHE is not shared by the Lambda instances, refusing idempotency keys and locking locations per instance")
+		}
+		hooksTTL, err := durationFromEnv("RING_WEBHOOKS_TTL", time.Minute)
+		if err == nil {
+			err = configureWebhooks(os.Getenv("RING_WEBHOOKS"), os.Getenv("RING_WEBHOOKS_DEAD_LETTERS"), hooksTTL)
+		}
+		if err != nil {
+			log.Printf("Invalid webhook configuration, not sending webhooks - %v", err)
+		}
+		if err := configurePoller(os.Getenv("RING_SNAPSHOT_STORE"), os.Getenv("RING_POLL_SINKS")); err != nil {
+			log.Printf("Invalid scheduled event configuration, not looking for changes - %v", err)
+		}
+		lambda.Start(invoke)
 	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/poller"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// scheduledPoller looks for changes on scheduled events, nil until configurePoller.
+var scheduledPoller *poller.Poller
+
+// configurePoller keeps the state of the scheduled runs in the store spec and
+// sends the changes to the sinks spec. Without sinks the changes go to the
+// webhooks when there are any, otherwise to the log.
+func configurePoller(storeSpec, sinksSpec string) error {
+	store, err := poller.NewStore(storeSpec)
+	if err != nil {
+		return err
+	}
+	if sinksSpec == "" && dispatcher != nil {
+		sinksSpec = "webhooks"
+	}
+	sinks, err := poller.NewSinks(sinksSpec, dispatcher)
+	if err != nil {
+		return err
+	}
+	scheduledPoller = &poller.Poller{Store: store, Sinks: sinks}
+	return nil
+}
+
+// invoke is the Lambda entry point. Scheduled EventBridge events look for
+// changes since the previous one, everything else is an API Gateway request.
+func invoke(payload json.RawMessage) (interface{}, error) {
+	var scheduled events.CloudWatchEvent
+	if err := json.Unmarshal(payload, &scheduled); err == nil && scheduled.Source == "aws.events" {
+		return nil, poll()
+	}
+	var request events.APIGatewayProxyRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, err
+	}
+	return Handler(request)
+}
+
+// poll sends the changes of the location of the refresh token to the sinks.
+func poll() error {
+	if scheduledPoller == nil {
+		return errors.New("invalid RING_SNAPSHOT_STORE or RING_POLL_SINKS, see the log of the cold start")
+	}
+	if tokens == nil {
+		return errors.New("scheduled events need the refresh token of RING_SECRET_BACKEND")
+	}
+	accessToken, err := tokens.AccessToken()
+	if err != nil {
+		return err
+	}
+	location, err := bridge.Location(accessToken)
+	if err != nil {
+		return err
+	}
+	_, err = scheduledPoller.Run(location.ID, accessToken)
+	if err != nil {
+		log.Printf("Unable to look for changes in location %v - %v", location.ID, err)
+	}
+	return err
+}
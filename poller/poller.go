@@ -0,0 +1,126 @@
+// Package poller compares the Ring devices and history with the previous run
+// and sends the changes to sinks. It backs the scheduled Lambda and the poll
+// command, for setups that can not keep a websocket connection open.
+package poller
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/bridge"
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+)
+
+// MaxHistoryAge limits how far back a run reads the history after a long pause.
+const MaxHistoryAge = 24 * time.Hour
+
+// State is what a run keeps for the next one.
+type State struct {
+	Devices alarmstate.Snapshot `json:"devices"`
+	// LastEventMs is the time of the newest history event sent.
+	LastEventMs int64     `json:"lastEventMs"`
+	Updated     time.Time `json:"updated"`
+}
+
+// HistoryEvent is a history event that is new since the previous run.
+type HistoryEvent struct {
+	Time    time.Time        `json:"time"`
+	Type    string           `json:"type"`
+	Context httputil.Context `json:"context"`
+}
+
+// Changes is what changed in a location since the previous run.
+type Changes struct {
+	LocationID string             `json:"locationId"`
+	Time       time.Time          `json:"time"`
+	Devices    []alarmstate.Event `json:"devices,omitempty"`
+	History    []HistoryEvent     `json:"history,omitempty"`
+}
+
+// Empty reports whether nothing changed.
+func (c Changes) Empty() bool {
+	return len(c.Devices) == 0 && len(c.History) == 0
+}
+
+// Poller runs the comparison.
+type Poller struct {
+	Store Store
+	Sinks []Sink
+}
+
+// Run reads the devices and history of the location, sends what changed since
+// the previous run to every sink and keeps the new state. The first run of a
+// location only keeps the state. A failing sink is logged and does not stop
+// the other sinks.
+func (p *Poller) Run(locationID, accessToken string) (Changes, error) {
+	now := time.Now()
+	previous, found, err := p.Store.Load(locationID)
+	if err != nil {
+		return Changes{}, err
+	}
+	from := now
+	if found {
+		from = time.Unix(0, previous.LastEventMs*int64(time.Millisecond))
+		if from.Before(now.Add(-MaxHistoryAge)) {
+			from = now.Add(-MaxHistoryAge)
+		}
+	}
+
+	// History and devices come from different Ring services, fetch them at the same time.
+	var (
+		wg         sync.WaitGroup
+		history    []HistoryEvent
+		historyErr error
+		devices    *httputil.RingDeviceInfo
+		devicesErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		historyErr = bridge.History(locationID, accessToken, from, now, func(event httputil.History) error {
+			if !found || event.Context.EventOccurredTsMs <= previous.LastEventMs {
+				return nil
+			}
+			history = append(history, HistoryEvent{Time: bridge.EventTime(event), Type: bridge.EventType(event), Context: event.Context})
+			return nil
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		devices, devicesErr = bridge.Devices(locationID, accessToken)
+	}()
+	wg.Wait()
+	if historyErr != nil {
+		return Changes{}, historyErr
+	}
+	if devicesErr != nil {
+		return Changes{}, devicesErr
+	}
+
+	// Ring returns the newest event first, send them in the order they happened.
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Time.Before(history[j].Time) })
+	current := State{Devices: alarmstate.NewSnapshot(devices), LastEventMs: now.UnixNano() / int64(time.Millisecond), Updated: now.UTC()}
+	changes := Changes{LocationID: locationID, Time: now.UTC(), History: history}
+	if found {
+		current.LastEventMs = previous.LastEventMs
+		if len(history) > 0 {
+			current.LastEventMs = history[len(history)-1].Context.EventOccurredTsMs
+		}
+		changes.Devices = alarmstate.Diff(previous.Devices, current.Devices, now)
+	} else {
+		log.Printf("No previous state of location %v, keeping it for the next run", locationID)
+	}
+
+	if !changes.Empty() {
+		log.Printf("%d device changes and %d history events in location %v", len(changes.Devices), len(changes.History), locationID)
+		for _, sink := range p.Sinks {
+			if err := sink.Send(changes); err != nil {
+				log.Printf("Unable to send the changes to %v - %v", sink, err)
+			}
+		}
+	}
+	return changes, p.Store.Save(locationID, current)
+}
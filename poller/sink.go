@@ -0,0 +1,145 @@
+package poller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/asishrs/smartthings-ringalarmv2/webhook"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+)
+
+// Sink receives the changes of a run.
+type Sink interface {
+	Send(changes Changes) error
+	String() string
+}
+
+// NewSinks creates the sinks of a comma separated spec:
+//
+//	log          - one CHANGES JSON line per run in the log (default)
+//	file:<path>  - one JSON line per run appended to the file
+//	webhooks     - the device changes are posted to the webhooks of dispatcher
+//	sns:<arn>    - one message per run published to the SNS topic
+func NewSinks(spec string, dispatcher *webhook.Dispatcher) ([]Sink, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "log"
+	}
+	var sinks []Sink
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "log":
+			sinks = append(sinks, LogSink{})
+		case strings.HasPrefix(part, "file:") && len(part) > len("file:"):
+			sinks = append(sinks, &FileSink{path: strings.TrimPrefix(part, "file:")})
+		case part == "webhooks":
+			if dispatcher == nil {
+				return nil, errors.New("poller: the webhooks sink needs webhooks to be configured")
+			}
+			sinks = append(sinks, WebhookSink{Dispatcher: dispatcher})
+		case strings.HasPrefix(part, "sns:") && len(part) > len("sns:"):
+			sinks = append(sinks, &SNSSink{TopicARN: strings.TrimPrefix(part, "sns:")})
+		default:
+			return nil, fmt.Errorf("poller: unknown sink %q, use log, file:<path>, webhooks or sns:<topic arn>", part)
+		}
+	}
+	return sinks, nil
+}
+
+// LogSink writes the changes to the log, CloudWatch for the Lambda.
+type LogSink struct{}
+
+// Send logs the changes as one line.
+func (LogSink) Send(changes Changes) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	log.Printf("CHANGES %s", data)
+	return nil
+}
+
+func (LogSink) String() string { return "log" }
+
+// FileSink appends the changes to a JSON lines file.
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Send appends the changes as one line.
+func (s *FileSink) Send(changes Changes) error {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *FileSink) String() string { return "file " + s.path }
+
+// WebhookSink posts the device changes to the subscribed webhooks. Failed
+// deliveries go to the dead letters of the dispatcher.
+type WebhookSink struct {
+	Dispatcher *webhook.Dispatcher
+}
+
+// Send delivers the webhook events of the device changes.
+func (s WebhookSink) Send(changes Changes) error {
+	s.Dispatcher.Notify(webhook.Notifications(changes.LocationID, changes.Devices))
+	return nil
+}
+
+func (WebhookSink) String() string { return "webhooks" }
+
+// SNSSink publishes the changes to an SNS topic.
+type SNSSink struct {
+	TopicARN string
+	// Client is created from the environment when nil.
+	Client snsiface.SNSAPI
+}
+
+// Send publishes the changes as a JSON message.
+func (s *SNSSink) Send(changes Changes) error {
+	if s.Client == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return err
+		}
+		s.Client = sns.New(sess)
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.Publish(&sns.PublishInput{
+		TopicArn: aws.String(s.TopicARN),
+		Subject:  aws.String("Ring Alarm changes"),
+		Message:  aws.String(string(data)),
+	})
+	return err
+}
+
+func (s *SNSSink) String() string { return "sns " + s.TopicARN }
@@ -0,0 +1,191 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Store keeps the state of each location between runs.
+type Store interface {
+	// Load returns the state of the location, false when there is none yet.
+	Load(locationID string) (State, bool, error)
+	Save(locationID string, state State) error
+	String() string
+}
+
+// NewStore creates a Store from a spec:
+//
+//	memory            - in process memory, kept across warm Lambda invocations (default)
+//	file:<dir>        - one JSON file per location under dir
+//	dynamodb:<table>  - one item per location in a table with the string keys pk and sk
+func NewStore(spec string) (Store, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return &MemoryStore{}, nil
+	case strings.HasPrefix(spec, "file:") && len(spec) > len("file:"):
+		return FileStore{Dir: strings.TrimPrefix(spec, "file:")}, nil
+	case strings.HasPrefix(spec, "dynamodb:") && len(spec) > len("dynamodb:"):
+		return &DynamoDBStore{Table: strings.TrimPrefix(spec, "dynamodb:")}, nil
+	default:
+		return nil, fmt.Errorf("poller: unknown store %q, use memory, file:<dir> or dynamodb:<table>", spec)
+	}
+}
+
+// MemoryStore keeps the states in process memory.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+// Load returns the state of the location.
+func (s *MemoryStore) Load(locationID string) (State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[locationID]
+	return state, ok, nil
+}
+
+// Save replaces the state of the location.
+func (s *MemoryStore) Save(locationID string, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states == nil {
+		s.states = map[string]State{}
+	}
+	s.states[locationID] = state
+	return nil
+}
+
+func (s *MemoryStore) String() string { return "memory" }
+
+// FileStore keeps the state of each location in <Dir>/<location>.json.
+type FileStore struct {
+	Dir string
+}
+
+func (s FileStore) path(locationID string) string {
+	return filepath.Join(s.Dir, filepath.Base(locationID)+".json")
+}
+
+// Load reads the file of the location. A missing file is no state.
+func (s FileStore) Load(locationID string) (State, bool, error) {
+	var state State
+	data, err := ioutil.ReadFile(s.path(locationID))
+	if os.IsNotExist(err) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false, fmt.Errorf("invalid state in %v: %v", s.path(locationID), err)
+	}
+	return state, true, nil
+}
+
+// Save writes the file of the location through a temporary file, so a crash never leaves half a state.
+func (s FileStore) Save(locationID string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.Dir, ".state-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(locationID))
+}
+
+func (s FileStore) String() string { return "file " + s.Dir }
+
+// DynamoDBStore keeps the state of each location as an item with pk
+// "poller#<location>" and sk "state". The keys match the audit log table, so
+// both can share one table.
+type DynamoDBStore struct {
+	Table string
+	// Client is created from the environment when nil.
+	Client dynamodbiface.DynamoDBAPI
+}
+
+func (s *DynamoDBStore) client() (dynamodbiface.DynamoDBAPI, error) {
+	if s.Client == nil {
+		sess, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		s.Client = dynamodb.New(sess)
+	}
+	return s.Client, nil
+}
+
+func (s *DynamoDBStore) key(locationID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String("poller#" + locationID)},
+		"sk": {S: aws.String("state")},
+	}
+}
+
+// Load gets the item of the location.
+func (s *DynamoDBStore) Load(locationID string) (State, bool, error) {
+	var state State
+	client, err := s.client()
+	if err != nil {
+		return state, false, err
+	}
+	output, err := client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(s.Table),
+		Key:            s.key(locationID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return state, false, err
+	}
+	value, ok := output.Item["state"]
+	if !ok || value.S == nil {
+		return state, false, nil
+	}
+	if err := json.Unmarshal([]byte(*value.S), &state); err != nil {
+		return state, false, fmt.Errorf("invalid state in %v: %v", s, err)
+	}
+	return state, true, nil
+}
+
+// Save puts the item of the location. The state is stored as a JSON string.
+func (s *DynamoDBStore) Save(locationID string, state State) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	item := s.key(locationID)
+	item["state"] = &dynamodb.AttributeValue{S: aws.String(string(data))}
+	_, err = client.PutItem(&dynamodb.PutItemInput{TableName: aws.String(s.Table), Item: item})
+	return err
+}
+
+func (s *DynamoDBStore) String() string { return "dynamodb " + s.Table }
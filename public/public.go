@@ -1,6 +1,7 @@
 package public
 
 import (
+	"github.com/asishrs/smartthings-ringalarmv2/audit"
 	"github.com/asishrs/smartthings-ringalarmv2/httputil"
 )
 
@@ -12,6 +13,26 @@ type Request struct {
 	HistoryLimit int    `json:"historyLimit"`
 	RefreshToken string `json:"refreshToken"`
 	AccessToken  string `json:"accessToken"`
+	DisarmCode   string `json:"disarmCode"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Limit        int    `json:"limit"`
+	AuditAction  string `json:"auditAction"`
+	// IdempotencyKey makes a repeated home, away or off return the first result.
+	IdempotencyKey string `json:"idempotencyKey"`
+	// Version is the state version the status/wait client knows.
+	Version string `json:"version"`
+	// Since is the time in milliseconds of the state the client knows, see
+	// status and status/wait.
+	Since int64 `json:"since"`
+	// Timeout is how many seconds status/wait waits for a change.
+	Timeout int `json:"timeout"`
+	// AccessCode is the keypad code to add, update or remove, see the codes actions.
+	AccessCode AccessCode `json:"accessCode"`
+	// Command is the device command of device/{zid}/command, e.g. switch.on.
+	Command string `json:"command"`
+	// Level is the level from 0 to 100 of dimmer.level.
+	Level *int `json:"level"`
 }
 
 // RingDeviceStatus represents the Device data on Ring Alarm Devices
@@ -21,6 +42,8 @@ type RingDeviceStatus struct {
 	Type    string `json:"type"`
 	Faulted bool   `json:"faulted"`
 	Mode    string `json:"mode"`
+	// LastUpdate is the time in milliseconds Ring last heard from the device.
+	LastUpdate int64 `json:"lastUpdate,omitempty"`
 }
 
 type RingDeviceEvent struct {
@@ -32,6 +55,12 @@ type RingDeviceEvent struct {
 type DeviceResponse struct {
 	DeviceStatus []RingDeviceStatus `json:"deviceStatus"`
 	Events       []RingDeviceEvent  `json:"events"`
+	// Version identifies the state of the devices, see status/wait.
+	Version string `json:"version"`
+	// Delta is set when the response only holds what changed after since.
+	Delta bool `json:"delta,omitempty"`
+	// Changed is set by status/wait, false when it timed out without a change.
+	Changed *bool `json:"changed,omitempty"`
 }
 
 type Address struct {
@@ -61,6 +90,32 @@ type ModeChangeResponse struct {
 	Message string `json:"message"`
 }
 
+// AccessCode is a keypad access code. A code with Start and End (RFC 3339)
+// only works between them. Ring never returns the code itself.
+type AccessCode struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Code  string `json:"code,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type AccessCodesResponse struct {
+	Codes []AccessCode `json:"codes"`
+}
+
+type DeviceCommandResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Command string `json:"command"`
+	Message string `json:"message"`
+}
+
+type AuditResponse struct {
+	Events []audit.Event `json:"events"`
+}
+
 type ProcessError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
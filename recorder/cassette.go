@@ -0,0 +1,77 @@
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// Frame directions inside a recorded websocket session.
+const (
+	Sent     = "sent"
+	Received = "received"
+)
+
+// HTTPRequest is a redacted HTTP request sent to Ring.
+type HTTPRequest struct {
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+}
+
+// HTTPResponse is a redacted HTTP response received from Ring.
+type HTTPResponse struct {
+	StatusCode int                 `json:"statusCode"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Body       string              `json:"body,omitempty"`
+}
+
+// HTTPInteraction is one HTTP request/response exchange.
+type HTTPInteraction struct {
+	Request  HTTPRequest  `json:"request"`
+	Response HTTPResponse `json:"response"`
+}
+
+// Frame is one websocket message sent to or received from Ring.
+type Frame struct {
+	Direction   string `json:"direction"`
+	MessageType int    `json:"messageType"`
+	Data        string `json:"data"`
+	OffsetMs    int64  `json:"offsetMs"`
+}
+
+// WSSession is every frame exchanged over one websocket connection.
+type WSSession struct {
+	URL    string  `json:"url"`
+	Frames []Frame `json:"frames"`
+}
+
+// Cassette is a redacted recording of the Ring HTTP and websocket traffic.
+type Cassette struct {
+	RecordedAt time.Time         `json:"recordedAt"`
+	HTTP       []HTTPInteraction `json:"http"`
+	WebSocket  []WSSession       `json:"websocket"`
+}
+
+// Load reads a cassette from the file.
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, err
+	}
+	return &cassette, nil
+}
+
+// Save writes the cassette to the file.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,151 @@
+package recorder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
+)
+
+// Recorder captures every HTTP exchange and websocket frame into a redacted cassette.
+type Recorder struct {
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{cassette: Cassette{RecordedAt: time.Now().UTC()}}
+}
+
+// Install wraps httputil.Client and wsutil.Dial so all Ring traffic is recorded.
+func (r *Recorder) Install() {
+	httputil.Client.Transport = r.Transport(httputil.Client.Transport)
+	wsutil.Dial = r.Dial(wsutil.Dial)
+}
+
+// Cassette returns a copy of everything recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cassette := r.cassette
+	cassette.HTTP = append([]HTTPInteraction(nil), r.cassette.HTTP...)
+	cassette.WebSocket = append([]WSSession(nil), r.cassette.WebSocket...)
+	return &cassette
+}
+
+// Save writes everything recorded so far to the file.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// Transport returns a RoundTripper recording every exchange made through base.
+// A nil base uses http.DefaultTransport.
+func (r *Recorder) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &recordingTransport{recorder: r, base: base}
+}
+
+// Dial returns a dial function recording every frame sent over connections opened with dial.
+func (r *Recorder) Dial(dial func(string) (wsutil.Conn, error)) func(string) (wsutil.Conn, error) {
+	return func(url string) (wsutil.Conn, error) {
+		conn, err := dial(url)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.cassette.WebSocket = append(r.cassette.WebSocket, WSSession{URL: redactURL(url)})
+		index := len(r.cassette.WebSocket) - 1
+		r.mu.Unlock()
+		return &recordingConn{Conn: conn, recorder: r, index: index, start: time.Now()}, nil
+	}
+}
+
+type recordingTransport struct {
+	recorder *Recorder
+	base     http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		requestBody = body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+
+	interaction := HTTPInteraction{
+		Request: HTTPRequest{
+			Method:  req.Method,
+			URL:     redactURL(req.URL.String()),
+			Headers: redactHeaders(req.Header),
+			Body:    redactBody(string(requestBody)),
+		},
+		Response: HTTPResponse{
+			StatusCode: res.StatusCode,
+			Headers:    redactHeaders(res.Header),
+			Body:       redactBody(string(responseBody)),
+		},
+	}
+	t.recorder.mu.Lock()
+	t.recorder.cassette.HTTP = append(t.recorder.cassette.HTTP, interaction)
+	t.recorder.mu.Unlock()
+	return res, nil
+}
+
+type recordingConn struct {
+	wsutil.Conn
+	recorder *Recorder
+	index    int
+	start    time.Time
+}
+
+func (c *recordingConn) record(direction string, messageType int, data []byte) {
+	frame := Frame{
+		Direction:   direction,
+		MessageType: messageType,
+		Data:        redactFrame(string(data)),
+		OffsetMs:    int64(time.Since(c.start) / time.Millisecond),
+	}
+	c.recorder.mu.Lock()
+	session := &c.recorder.cassette.WebSocket[c.index]
+	session.Frames = append(session.Frames, frame)
+	c.recorder.mu.Unlock()
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) {
+	messageType, data, err := c.Conn.ReadMessage()
+	if err == nil {
+		c.record(Received, messageType, data)
+	}
+	return messageType, data, err
+}
+
+func (c *recordingConn) WriteMessage(messageType int, data []byte) error {
+	err := c.Conn.WriteMessage(messageType, data)
+	if err == nil {
+		c.record(Sent, messageType, data)
+	}
+	return err
+}
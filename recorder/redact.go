@@ -0,0 +1,158 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces every secret or personal value in a cassette.
+const Redacted = "REDACTED"
+
+// redactedHeaders are the request and response headers that are never written to a cassette.
+var redactedHeaders = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"set-cookie":    true,
+	"2fa-code":      true,
+}
+
+// redactedKeys are the JSON keys, query and form parameters that are scrubbed from a cassette.
+var redactedKeys = map[string]bool{
+	"access_token":         true,
+	"refresh_token":        true,
+	"accesstoken":          true,
+	"refreshtoken":         true,
+	"password":             true,
+	"username":             true,
+	"user":                 true,
+	"email":                true,
+	"phone":                true,
+	"first_name":           true,
+	"last_name":            true,
+	"authcode":             true,
+	"accountid":            true,
+	"location_id":          true,
+	"locationid":           true,
+	"owner_id":             true,
+	"address1":             true,
+	"address2":             true,
+	"zip_code":             true,
+	"latitude":             true,
+	"longitude":            true,
+	"ipaddress":            true,
+	"useragent":            true,
+	"initiatingentityname": true,
+	"initiatingentityid":   true,
+	"serialnumber":         true,
+	"code":                 true,
+	"access_code":          true,
+	"accesscode":           true,
+	"disarmcode":           true,
+	"passcode":             true,
+	"pin":                  true,
+}
+
+func isRedactedKey(key string) bool {
+	return redactedKeys[strings.ToLower(key)]
+}
+
+func redactHeaders(headers http.Header) map[string][]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	redacted := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		if redactedHeaders[strings.ToLower(name)] {
+			redacted[name] = []string{Redacted}
+			continue
+		}
+		redacted[name] = values
+	}
+	return redacted
+}
+
+// redactURL scrubs the query parameters of the url.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	u.RawQuery = redactQuery(u.Query()).Encode()
+	return u.String()
+}
+
+func redactQuery(values url.Values) url.Values {
+	for key := range values {
+		if isRedactedKey(key) {
+			values.Set(key, Redacted)
+		}
+	}
+	return values
+}
+
+// redactBody scrubs a JSON or form encoded body. Anything else is kept as is.
+func redactBody(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if trimmed == "" {
+		return body
+	}
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var value interface{}
+		if err := json.Unmarshal([]byte(trimmed), &value); err != nil {
+			return body
+		}
+		result, err := json.Marshal(redactValue(value))
+		if err != nil {
+			return body
+		}
+		return string(result)
+	}
+	if strings.Contains(trimmed, "=") && !strings.ContainsAny(trimmed, " \n") {
+		values, err := url.ParseQuery(trimmed)
+		if err != nil {
+			return body
+		}
+		return redactQuery(values).Encode()
+	}
+	return body
+}
+
+// redactFrame scrubs a socket.io frame, which is a packet type prefix followed by JSON.
+func redactFrame(frame string) string {
+	i := 0
+	for i < len(frame) && frame[i] >= '0' && frame[i] <= '9' {
+		i++
+	}
+	if i == len(frame) {
+		return frame
+	}
+	return frame[:i] + redactBody(frame[i:])
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if isRedactedKey(key) && !isContainer(child) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(child)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
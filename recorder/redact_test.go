@@ -0,0 +1,176 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "json tokens",
+			body: `{"access_token":"secret","token_type":"Bearer","refresh_token":"secret"}`,
+			want: `{"access_token":"REDACTED","refresh_token":"REDACTED","token_type":"Bearer"}`,
+		},
+		{
+			name: "keys in any case",
+			body: `{"accessToken":"secret","RefreshToken":"secret"}`,
+			want: `{"RefreshToken":"REDACTED","accessToken":"REDACTED"}`,
+		},
+		{
+			name: "nested objects and lists",
+			body: `{"user_locations":[{"location_id":"1234","name":"Home","address":{"address1":"1 Main St","zip_code":"12345"}}]}`,
+			want: `{"user_locations":[{"address":{"address1":"REDACTED","zip_code":"REDACTED"},"location_id":"REDACTED","name":"Home"}]}`,
+		},
+		{
+			name: "access code command",
+			body: `{"msg":"DeviceInfoSet","body":[{"command":{"v1":[{"commandType":"vault.add-code","data":{"name":"Dog walker","code":"1234"}}]}}]}`,
+			want: `{"body":[{"command":{"v1":[{"commandType":"vault.add-code","data":{"code":"REDACTED","name":"Dog walker"}}]}}],"msg":"DeviceInfoSet"}`,
+		},
+		{
+			name: "pin and disarm code",
+			body: `{"pin":"0000","disarmCode":"1234","accessCode":"5678","mode":"none"}`,
+			want: `{"accessCode":"REDACTED","disarmCode":"REDACTED","mode":"none","pin":"REDACTED"}`,
+		},
+		{
+			name: "redacted key holding an object",
+			body: `{"user":{"id":1,"email":"me@example.com"}}`,
+			want: `{"user":{"email":"REDACTED","id":1}}`,
+		},
+		{
+			name: "form",
+			body: "client_id=ring_official_android&grant_type=password&password=secret&username=me%40example.com",
+			want: "client_id=ring_official_android&grant_type=password&password=REDACTED&username=REDACTED",
+		},
+		{
+			name: "form refresh",
+			body: "grant_type=refresh_token&refresh_token=secret",
+			want: "grant_type=refresh_token&refresh_token=REDACTED",
+		},
+		{
+			name: "plain text",
+			body: "no secrets here",
+			want: "no secrets here",
+		},
+		{
+			name: "invalid json",
+			body: `{"access_token":`,
+			want: `{"access_token":`,
+		},
+		{
+			name: "empty",
+			body: "",
+			want: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := redactBody(test.body); got != test.want {
+				t.Errorf("redactBody() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want url.Values
+	}{
+		{
+			name: "location and token",
+			url:  "https://app.ring.com/api/v1/rs/connections?accountId=1&location_id=2&access_token=secret",
+			want: url.Values{"accountId": {Redacted}, "location_id": {Redacted}, "access_token": {Redacted}},
+		},
+		{
+			name: "kept parameters",
+			url:  "https://api.ring.com/clients_api/locations?limit=50&offset=0",
+			want: url.Values{"limit": {"50"}, "offset": {"0"}},
+		},
+		{
+			name: "websocket auth code",
+			url:  "wss://example.com/socket.io/?authcode=secret&ack=false&EIO=3",
+			want: url.Values{"authcode": {Redacted}, "ack": {"false"}, "EIO": {"3"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redacted, err := url.Parse(redactURL(test.url))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := redacted.Query(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("redactURL() query = %v, want %v", got, test.want)
+			}
+			if strings.Contains(redacted.String(), "secret") {
+				t.Errorf("redactURL() = %v, holds a secret", redacted)
+			}
+		})
+	}
+	if got := redactURL("https://api.ring.com/clients_api/locations"); got != "https://api.ring.com/clients_api/locations" {
+		t.Errorf("redactURL() without a query = %v", got)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	headers := http.Header{
+		"Authorization": {"Bearer secret"},
+		"2fa-Code":      {"123456"},
+		"Set-Cookie":    {"session=secret"},
+		"Content-Type":  {"application/json"},
+	}
+	want := map[string][]string{
+		"Authorization": {Redacted},
+		"2fa-Code":      {Redacted},
+		"Set-Cookie":    {Redacted},
+		"Content-Type":  {"application/json"},
+	}
+	if got := redactHeaders(headers); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactHeaders() = %v, want %v", got, want)
+	}
+}
+
+func TestRedactFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  string
+	}{
+		{name: "event", frame: `42["message",{"code":"1234"}]`, want: `42["message",{"code":"REDACTED"}]`},
+		{name: "ping", frame: "2", want: "2"},
+		{name: "open", frame: `0{"sid":"abc","pingInterval":25000}`, want: `0{"pingInterval":25000,"sid":"abc"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := redactFrame(test.frame)
+			if !equalJSONFrame(got, test.want) {
+				t.Errorf("redactFrame() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// equalJSONFrame compares the packet type and the JSON of two frames.
+func equalJSONFrame(a, b string) bool {
+	i, j := strings.IndexAny(a, "{["), strings.IndexAny(b, "{[")
+	if i < 0 || j < 0 {
+		return a == b
+	}
+	if a[:i] != b[:j] {
+		return false
+	}
+	var x, y interface{}
+	if json.Unmarshal([]byte(a[i:]), &x) != nil || json.Unmarshal([]byte(b[j:]), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
@@ -0,0 +1,140 @@
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/wsutil"
+	"github.com/gorilla/websocket"
+)
+
+// Replayer serves a cassette back in place of the Ring API. Requests are
+// matched on method and redacted url in the order they were recorded.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	usedHTTP []bool
+	usedWS   []bool
+}
+
+// NewReplayer creates a Replayer for the cassette.
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{
+		cassette: cassette,
+		usedHTTP: make([]bool, len(cassette.HTTP)),
+		usedWS:   make([]bool, len(cassette.WebSocket)),
+	}
+}
+
+// Install replaces httputil.Client and wsutil.Dial so all Ring traffic is served from the cassette.
+func (r *Replayer) Install() {
+	httputil.Client.Transport = r
+	wsutil.Dial = r.Dial
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	url := redactURL(req.URL.String())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.HTTP {
+		if r.usedHTTP[i] || interaction.Request.Method != req.Method || interaction.Request.URL != url {
+			continue
+		}
+		r.usedHTTP[i] = true
+		header := http.Header{}
+		for name, values := range interaction.Response.Headers {
+			header[name] = values
+		}
+		// The recorded body is redacted, so the recorded length no longer applies.
+		header.Del("Content-Length")
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewBufferString(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("recorder: no recorded response for %s %s", req.Method, url)
+}
+
+// Dial serves the next recorded websocket session for the url.
+func (r *Replayer) Dial(url string) (wsutil.Conn, error) {
+	url = redactURL(url)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, session := range r.cassette.WebSocket {
+		if r.usedWS[i] || session.URL != url {
+			continue
+		}
+		r.usedWS[i] = true
+		conn := &replayConn{frames: session.Frames}
+		conn.cond = sync.NewCond(&conn.mu)
+		return conn, nil
+	}
+	return nil, fmt.Errorf("recorder: no recorded websocket session for %s", url)
+}
+
+// replayConn hands out the received frames of a session. Frames recorded
+// after a sent frame are held back until the client writes that frame.
+type replayConn struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	frames []Frame
+	next   int
+	closed bool
+}
+
+func (c *replayConn) ReadMessage() (int, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		if c.next < len(c.frames) && c.frames[c.next].Direction == Received {
+			frame := c.frames[c.next]
+			c.next++
+			return frame.MessageType, []byte(frame.Data), nil
+		}
+		if c.closed {
+			return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+		}
+		c.cond.Wait()
+	}
+}
+
+func (c *replayConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return websocket.ErrCloseSent
+	}
+	if c.next < len(c.frames) && c.frames[c.next].Direction == Sent {
+		c.next++
+	}
+	if messageType == websocket.CloseMessage {
+		c.closed = true
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.cond.Broadcast()
+	return nil
+}
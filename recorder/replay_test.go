@@ -0,0 +1,145 @@
+package recorder
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReplayRoundTrip(t *testing.T) {
+	ring := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/token":
+			w.Write([]byte(`{"access_token":"access-secret","refresh_token":"refresh-secret","expires_in":3600}`))
+		case "/locations":
+			w.Write([]byte(`{"user_locations":[{"location_id":"1234","name":"Home"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ring.Close()
+
+	recorder := NewRecorder()
+	client := &http.Client{Transport: recorder.Transport(nil)}
+	requests := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{method: "POST", url: ring.URL + "/oauth/token", body: "grant_type=refresh_token&refresh_token=refresh-secret"},
+		{method: "GET", url: ring.URL + "/locations?access_token=access-secret"},
+		{method: "GET", url: ring.URL + "/locations?access_token=access-secret"},
+	}
+	var recorded []string
+	for _, request := range requests {
+		req, err := http.NewRequest(request.method, request.url, strings.NewReader(request.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		recorded = append(recorded, string(body))
+	}
+	if recorded[0] != `{"access_token":"access-secret","refresh_token":"refresh-secret","expires_in":3600}` {
+		t.Errorf("recording changed the response to %v", recorded[0])
+	}
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"access-secret", "refresh-secret", "1234"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the cassette holds %q", secret)
+		}
+	}
+
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := NewReplayer(cassette)
+	client = &http.Client{Transport: replayer}
+	want := []string{
+		`{"access_token":"REDACTED","expires_in":3600,"refresh_token":"REDACTED"}`,
+		`{"user_locations":[{"location_id":"REDACTED","name":"Home"}]}`,
+		`{"user_locations":[{"location_id":"REDACTED","name":"Home"}]}`,
+	}
+	for i, request := range requests {
+		// The replayed tokens differ from the recorded ones, the url still matches.
+		url := strings.Replace(request.url, "access-secret", "other-token", 1)
+		req, err := http.NewRequest(request.method, url, strings.NewReader(request.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("replay of %v %v: %v", request.method, request.url, err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || string(body) != want[i] {
+			t.Errorf("replay %d = %v %v, want 200 %v", i, res.StatusCode, string(body), want[i])
+		}
+	}
+
+	// Every recorded exchange is served once.
+	req, _ := http.NewRequest("GET", ring.URL+"/locations?access_token=access-secret", nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("a fourth replay of two recorded requests succeeded")
+	}
+}
+
+func TestReplayWebSocket(t *testing.T) {
+	cassette := &Cassette{WebSocket: []WSSession{{
+		URL: "wss://example.com/socket.io/?authcode=REDACTED",
+		Frames: []Frame{
+			{Direction: Received, MessageType: websocket.TextMessage, Data: `0{"sid":"abc"}`},
+			{Direction: Sent, MessageType: websocket.TextMessage, Data: `42["message",{"msg":"DeviceInfoDocGetList","seq":1}]`},
+			{Direction: Received, MessageType: websocket.TextMessage, Data: `42["message",{"msg":"DeviceInfoDocGetList","seq":1,"body":[]}]`},
+		},
+	}}}
+	replayer := NewReplayer(cassette)
+	if _, err := replayer.Dial("wss://example.com/socket.io/?authcode=other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replayer.Dial("wss://example.com/socket.io/?authcode=other"); err == nil {
+		t.Error("a second session of one recorded session was served")
+	}
+
+	conn, _ := NewReplayer(cassette).Dial("wss://example.com/socket.io/?authcode=other")
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != `0{"sid":"abc"}` {
+		t.Fatalf("first ReadMessage() = %s, %v", data, err)
+	}
+	// The reply is held back until the request is sent.
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`42["message",{"msg":"DeviceInfoDocGetList","seq":1}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || !strings.Contains(string(data), `"body":[]`) {
+		t.Fatalf("second ReadMessage() = %s, %v", data, err)
+	}
+	conn.Close()
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("ReadMessage() after Close() succeeded")
+	}
+}
@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned while the circuit breaker is open.
+type ErrOpen struct {
+	// RetryAfter is how long until the breaker lets a call through again.
+	RetryAfter time.Duration
+}
+
+func (e *ErrOpen) Error() string {
+	return fmt.Sprintf("Ring is unavailable, not calling it for another %v", e.RetryAfter.Round(time.Second))
+}
+
+// Breaker stops calls to a service after Threshold consecutive failures. Once
+// Cooldown has passed a single call is let through; its result closes the
+// breaker again or keeps it open for another Cooldown.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Allow returns an *ErrOpen error if the call must not be made.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Threshold <= 0 || b.failures < b.Threshold {
+		return nil
+	}
+	wait := b.Cooldown - time.Since(b.openedAt)
+	if wait > 0 || b.probing {
+		if wait <= 0 {
+			wait = b.Cooldown
+		}
+		return &ErrOpen{RetryAfter: wait}
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *Breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *Breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+// release ends a probe without a result, so the next call probes again.
+func (b *Breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
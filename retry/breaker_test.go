@@ -0,0 +1,227 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errRing = errors.New("ring failed")
+
+// refusedError is a typed error that reports itself permanent, like a 401 from Ring.
+type refusedError struct{}
+
+func (refusedError) Error() string   { return "ring refused the token" }
+func (refusedError) Permanent() bool { return true }
+
+var errRefused error = refusedError{}
+
+// step is a call through the breaker and what the breaker must answer.
+type step struct {
+	// wait moves the open breaker this far into its cooldown before the call.
+	wait time.Duration
+	// result is what the call returns when it is let through.
+	result error
+	// open is set when Allow must refuse the call.
+	open bool
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below the threshold",
+			steps: []step{
+				{result: errRing},
+				{result: errRing},
+				{result: nil},
+				{result: errRing},
+				{result: errRing},
+				{result: nil},
+			},
+		},
+		{
+			name: "opens at the threshold",
+			steps: []step{
+				{result: errRing},
+				{result: errRing},
+				{result: errRing},
+				{open: true},
+				{wait: time.Minute / 2, open: true},
+			},
+		},
+		{
+			name: "lets one probe through after the cooldown and closes on success",
+			steps: []step{
+				{result: errRing},
+				{result: errRing},
+				{result: errRing},
+				{wait: time.Minute, result: nil},
+				{result: errRing},
+				{result: nil},
+			},
+		},
+		{
+			name: "reopens when the probe fails",
+			steps: []step{
+				{result: errRing},
+				{result: errRing},
+				{result: errRing},
+				{wait: time.Minute, result: errRing},
+				{open: true},
+				{wait: time.Minute, result: nil},
+				{result: nil},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := &Breaker{Threshold: 3, Cooldown: time.Minute}
+			for i, step := range test.steps {
+				breaker.openedAt = breaker.openedAt.Add(-step.wait)
+				err := breaker.Allow()
+				var open *ErrOpen
+				if step.open {
+					if !errors.As(err, &open) {
+						t.Fatalf("step %v: Allow() = %v, want ErrOpen", i, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %v: Allow() = %v, want nil", i, err)
+				}
+				if step.result == nil {
+					breaker.success()
+				} else {
+					breaker.failure()
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	breaker := &Breaker{Threshold: 1, Cooldown: time.Minute}
+	breaker.failure()
+	breaker.openedAt = breaker.openedAt.Add(-time.Minute)
+
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("probe: Allow() = %v, want nil", err)
+	}
+	var open *ErrOpen
+	if err := breaker.Allow(); !errors.As(err, &open) {
+		t.Fatalf("second call while probing: Allow() = %v, want ErrOpen", err)
+	}
+	if open.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want %v", open.RetryAfter, time.Minute)
+	}
+}
+
+func TestDoBreaker(t *testing.T) {
+	tests := []struct {
+		name string
+		// fn is the call made as the probe of an open breaker.
+		fn      func() error
+		wantErr error
+		// wantProbe is set when the next call must be let through as a new probe.
+		wantProbe bool
+		// wantClosed is set when the breaker must be closed afterwards.
+		wantClosed bool
+	}{
+		{
+			name:       "success closes the breaker",
+			fn:         func() error { return nil },
+			wantClosed: true,
+		},
+		{
+			name:    "failure keeps the breaker open",
+			fn:      func() error { return errRing },
+			wantErr: errRing,
+		},
+		{
+			name:      "permanent error ends the probe",
+			fn:        func() error { return Permanent(errRing) },
+			wantErr:   errRing,
+			wantProbe: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := &Breaker{Threshold: 1, Cooldown: time.Minute}
+			breaker.failure()
+			breaker.openedAt = breaker.openedAt.Add(-time.Minute)
+			policy := Policy{Attempts: 1, Breaker: breaker}
+
+			if err := policy.Do("Test", test.fn); err != test.wantErr {
+				t.Fatalf("Do() = %v, want %v", err, test.wantErr)
+			}
+			err := breaker.Allow()
+			switch {
+			case test.wantClosed || test.wantProbe:
+				if err != nil {
+					t.Errorf("Allow() = %v, want nil", err)
+				}
+			default:
+				var open *ErrOpen
+				if !errors.As(err, &open) {
+					t.Errorf("Allow() = %v, want ErrOpen", err)
+				}
+			}
+			if test.wantClosed && breaker.failures != 0 {
+				t.Errorf("failures = %v, want 0", breaker.failures)
+			}
+		})
+	}
+}
+
+func TestDoPermanentNotCounted(t *testing.T) {
+	breaker := &Breaker{Threshold: 2, Cooldown: time.Minute}
+	policy := Policy{Attempts: 3, Breaker: breaker}
+	// One caller with a bad token must not open the breaker for everyone.
+	for i := 0; i < 5; i++ {
+		if err := policy.Do("Test", func() error { return errRefused }); err != errRefused {
+			t.Fatalf("Do() = %v, want %v", err, errRefused)
+		}
+	}
+	if err := breaker.Allow(); err != nil {
+		t.Errorf("Allow() after permanent errors = %v, want nil", err)
+	}
+	if breaker.failures != 0 {
+		t.Errorf("failures = %v, want 0", breaker.failures)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "first call succeeds", results: []error{nil}, wantCalls: 1},
+		{name: "succeeds after a failure", results: []error{errRing, nil}, wantCalls: 2},
+		{name: "gives up after the attempts", results: []error{errRing, errRing, errRing}, wantCalls: 3, wantErr: errRing},
+		{name: "permanent error is not retried", results: []error{Permanent(errRing)}, wantCalls: 1, wantErr: errRing},
+		{name: "typed permanent error is not retried", results: []error{errRefused}, wantCalls: 1, wantErr: errRefused},
+		{name: "wrapped typed permanent error is not retried", results: []error{fmt.Errorf("location: %w", errRefused)}, wantCalls: 1, wantErr: errRefused},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := Policy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+			calls := 0
+			err := policy.Do("Test", func() error {
+				calls++
+				return test.results[calls-1]
+			})
+			if !errors.Is(err, test.wantErr) || (err == nil) != (test.wantErr == nil) {
+				t.Errorf("Do() = %v, want %v", err, test.wantErr)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("calls = %v, want %v", calls, test.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Policy retries a call with jittered exponential backoff.
+type Policy struct {
+	// Attempts is the total number of calls, including the first one.
+	Attempts int
+	// BaseDelay is the backoff before the second attempt, doubled for every further attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between two attempts.
+	MaxDelay time.Duration
+	// Breaker, when set, fails calls fast while it is open and counts their results.
+	Breaker *Breaker
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+// Permanent marks an error that must not be retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// permanent returns the error to report when err must not be retried, either
+// marked with Permanent or with a Permanent() method that reports true.
+func permanent(err error) (error, bool) {
+	var marked permanentError
+	if errors.As(err, &marked) {
+		return marked.err, true
+	}
+	var typed interface{ Permanent() bool }
+	if errors.As(err, &typed) && typed.Permanent() {
+		return err, true
+	}
+	return nil, false
+}
+
+var (
+	randMu sync.Mutex
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Do calls fn until it succeeds, returns a permanent error or the attempts run out.
+// The last error is returned. Permanent errors are not counted by the breaker,
+// a caller with a bad token says nothing about the service. ErrOpen is returned without calling fn while the breaker is open.
+// fn must not call Do of a policy with the same breaker, the inner call would
+// find the breaker probing and fail with ErrOpen.
+func (p Policy) Do(name string, fn func() error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if p.Breaker != nil {
+			if openErr := p.Breaker.Allow(); openErr != nil {
+				return openErr
+			}
+		}
+		err = fn()
+		if permanentErr, ok := permanent(err); ok {
+			// The call says nothing about the service, but it may have been the probe.
+			p.Breaker.release()
+			return permanentErr
+		}
+		if err == nil {
+			p.Breaker.success()
+			return nil
+		}
+		p.Breaker.failure()
+		if attempt < attempts {
+			delay := p.backoff(attempt)
+			log.Printf("%v failed (attempt %d of %d), retrying in %v - %v", name, attempt, attempts, delay, err)
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
+
+// backoff returns a random delay up to BaseDelay * 2^(attempt-1), capped at MaxDelay.
+func (p Policy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := p.BaseDelay << uint(attempt-1)
+	if p.MaxDelay > 0 && (ceiling > p.MaxDelay || ceiling <= 0) {
+		ceiling = p.MaxDelay
+	}
+	randMu.Lock()
+	defer randMu.Unlock()
+	return time.Duration(random.Int63n(int64(ceiling) + 1))
+}
@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+var (
+	awsSession     *session.Session
+	awsSessionErr  error
+	awsSessionOnce sync.Once
+)
+
+// newAWSSession returns the shared session, configured from the Lambda environment.
+func newAWSSession() (*session.Session, error) {
+	awsSessionOnce.Do(func() {
+		awsSession, awsSessionErr = session.NewSession()
+	})
+	return awsSession, awsSessionErr
+}
+
+// SecretsManager keeps the secret as the SecretString of an AWS Secrets Manager secret.
+type SecretsManager struct {
+	SecretID string
+	// Client is created from the environment when nil.
+	Client secretsmanageriface.SecretsManagerAPI
+}
+
+func (s *SecretsManager) client() (secretsmanageriface.SecretsManagerAPI, error) {
+	if s.Client == nil {
+		sess, err := newAWSSession()
+		if err != nil {
+			return nil, err
+		}
+		s.Client = secretsmanager.New(sess)
+	}
+	return s.Client, nil
+}
+
+// Get returns the current version of the secret.
+func (s *SecretsManager) Get() (string, error) {
+	client, err := s.client()
+	if err != nil {
+		return "", err
+	}
+	output, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(s.SecretID)})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.SecretString), nil
+}
+
+// Put stores the value as a new version of the secret.
+func (s *SecretsManager) Put(value string) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	_, err = client.PutSecretValue(&secretsmanager.PutSecretValueInput{SecretId: aws.String(s.SecretID), SecretString: aws.String(value)})
+	return err
+}
+
+func (s *SecretsManager) String() string {
+	return "Secrets Manager secret " + s.SecretID
+}
+
+// SSM keeps the secret in an SSM Parameter Store SecureString parameter.
+type SSM struct {
+	Name string
+	// Client is created from the environment when nil.
+	Client ssmiface.SSMAPI
+}
+
+func (s *SSM) client() (ssmiface.SSMAPI, error) {
+	if s.Client == nil {
+		sess, err := newAWSSession()
+		if err != nil {
+			return nil, err
+		}
+		s.Client = ssm.New(sess)
+	}
+	return s.Client, nil
+}
+
+// Get returns the decrypted value of the parameter.
+func (s *SSM) Get() (string, error) {
+	client, err := s.client()
+	if err != nil {
+		return "", err
+	}
+	output, err := client.GetParameter(&ssm.GetParameterInput{Name: aws.String(s.Name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Parameter.Value), nil
+}
+
+// Put overwrites the parameter as a SecureString.
+func (s *SSM) Put(value string) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+	_, err = client.PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(s.Name),
+		Value:     aws.String(value),
+		Type:      aws.String(ssm.ParameterTypeSecureString),
+		Overwrite: aws.Bool(true),
+	})
+	return err
+}
+
+func (s *SSM) String() string {
+	return "SSM parameter " + s.Name
+}
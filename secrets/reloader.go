@@ -0,0 +1,38 @@
+package secrets
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Reloader keeps a value read from a backend and reads it again once its TTL
+// passed, so a changed secret is used within the TTL. The zero value is ready
+// to use.
+type Reloader struct {
+	mu       sync.Mutex
+	value    interface{}
+	loadedAt time.Time
+}
+
+// Get returns the value, calling read when nothing was read yet or ttl passed
+// since the last read. When read fails after an earlier success the previous
+// value is kept and the error is logged with what, e.g. "API keys".
+func (r *Reloader) Get(ttl time.Duration, what string, read func() (interface{}, error)) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < ttl {
+		return r.value, nil
+	}
+	value, err := read()
+	if err != nil {
+		if r.loadedAt.IsZero() {
+			return nil, err
+		}
+		log.Printf("Unable to read the %v, using the previous value - %v", what, err)
+		return r.value, nil
+	}
+	r.value = value
+	r.loadedAt = time.Now()
+	return value, nil
+}
@@ -0,0 +1,43 @@
+package secrets
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReloader(t *testing.T) {
+	var reloader Reloader
+	var reads int
+	var readErr error
+	read := func() (interface{}, error) {
+		reads++
+		if readErr != nil {
+			return nil, readErr
+		}
+		return reads, nil
+	}
+
+	readErr = errors.New("unavailable")
+	if _, err := reloader.Get(time.Minute, "test value", read); err != readErr {
+		t.Fatalf("Get() without a value = %v, want %v", err, readErr)
+	}
+
+	readErr = nil
+	if value, err := reloader.Get(time.Minute, "test value", read); err != nil || value != 2 {
+		t.Fatalf("Get() = %v, %v, want 2", value, err)
+	}
+	if value, _ := reloader.Get(time.Minute, "test value", read); value != 2 || reads != 2 {
+		t.Errorf("Get() within the TTL = %v after %v reads, want 2 after 2", value, reads)
+	}
+
+	// Once the TTL passed the value is read again, a failure keeps the previous one.
+	readErr = errors.New("unavailable")
+	if value, err := reloader.Get(0, "test value", read); err != nil || value != 2 || reads != 3 {
+		t.Errorf("Get() with a failed read = %v, %v after %v reads, want 2 after 3", value, err, reads)
+	}
+	readErr = nil
+	if value, _ := reloader.Get(0, "test value", read); value != 4 {
+		t.Errorf("Get() after the TTL = %v, want 4", value)
+	}
+}
@@ -0,0 +1,174 @@
+// Package secrets keeps the Ring refresh token of the Lambda outside of the
+// requests, in AWS Secrets Manager, SSM Parameter Store, a file or an
+// environment variable.
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Backend reads and writes one secret value.
+type Backend interface {
+	Get() (string, error)
+	Put(value string) error
+	// String describes where the secret is kept.
+	String() string
+}
+
+// New creates a Backend from a spec:
+//
+//	secretsmanager:<secret id>   - an AWS Secrets Manager secret
+//	ssm:<parameter name>         - an SSM Parameter Store SecureString
+//	file:<path>                  - a local file, for testing
+//	env:<name>                   - an environment variable, for testing; writes only last until restart
+func New(spec string) (Backend, error) {
+	kind := strings.SplitN(spec, ":", 2)
+	if len(kind) != 2 || kind[1] == "" {
+		return nil, fmt.Errorf("secrets: invalid backend %q, use secretsmanager:<id>, ssm:<name>, file:<path> or env:<name>", spec)
+	}
+	switch kind[0] {
+	case "secretsmanager":
+		return &SecretsManager{SecretID: kind[1]}, nil
+	case "ssm":
+		return &SSM{Name: kind[1]}, nil
+	case "file":
+		return File(kind[1]), nil
+	case "env":
+		return Env(kind[1]), nil
+	default:
+		return nil, fmt.Errorf("secrets: unknown backend %q", kind[0])
+	}
+}
+
+// refreshTokenKey is the key of the refresh token when the secret is a JSON object.
+const refreshTokenKey = "refreshToken"
+
+// RefreshToken reads the refresh token from the backend. The secret is either
+// the token itself or a JSON object with a refreshToken key, as the Secrets
+// Manager console creates them.
+func RefreshToken(backend Backend) (string, error) {
+	value, err := backend.Get()
+	if err != nil {
+		return "", err
+	}
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "{") {
+		return value, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secrets: %v is not valid JSON: %v", backend, err)
+	}
+	token, _ := fields[refreshTokenKey].(string)
+	if token == "" {
+		return "", fmt.Errorf("secrets: %v has no %v key", backend, refreshTokenKey)
+	}
+	return token, nil
+}
+
+// SaveRefreshToken writes the refresh token to the backend in the format the secret already has.
+func SaveRefreshToken(backend Backend, refreshToken string) error {
+	value, err := backend.Get()
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return backend.Put(refreshToken)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return backend.Put(refreshToken)
+	}
+	fields[refreshTokenKey] = refreshToken
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return backend.Put(string(data))
+}
+
+// File keeps the secret in a local file.
+type File string
+
+// Get returns the content of the file.
+func (f File) Get() (string, error) {
+	data, err := ioutil.ReadFile(string(f))
+	return string(data), err
+}
+
+// Put replaces the content of the file.
+func (f File) Put(value string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(string(f)), ".secret-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), string(f))
+}
+
+func (f File) String() string {
+	return "file " + string(f)
+}
+
+// Env keeps the secret in an environment variable.
+type Env string
+
+// Get returns the value of the variable.
+func (e Env) Get() (string, error) {
+	value, ok := os.LookupEnv(string(e))
+	if !ok {
+		return "", fmt.Errorf("secrets: %v is not set", string(e))
+	}
+	return value, nil
+}
+
+// Put sets the variable for this process only.
+func (e Env) Put(value string) error {
+	log.Printf("The new secret is kept in %v until the process restarts", string(e))
+	return os.Setenv(string(e), value)
+}
+
+func (e Env) String() string {
+	return "environment variable " + string(e)
+}
+
+// Memory keeps the secret in memory, for tests.
+type Memory struct {
+	mu    sync.Mutex
+	value string
+}
+
+// NewMemory creates a Memory holding the value.
+func NewMemory(value string) *Memory {
+	return &Memory{value: value}
+}
+
+// Get returns the value.
+func (m *Memory) Get() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.value, nil
+}
+
+// Put replaces the value.
+func (m *Memory) Put(value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value = value
+	return nil
+}
+
+func (m *Memory) String() string {
+	return "memory"
+}
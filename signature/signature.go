@@ -0,0 +1,186 @@
+// Package signature checks HMAC-SHA256 signed bridge requests.
+//
+// A signed request carries the headers
+//
+//	X-Ring-Bridge-Key        name of the signing key
+//	X-Ring-Bridge-Timestamp  unix time in seconds
+//	X-Ring-Bridge-Nonce      random value, used only once
+//	X-Ring-Bridge-Signature  hex HMAC-SHA256 of the string to sign
+//
+// The string to sign is the method, the path (/<action>), the canonical query
+// string, the timestamp, the nonce, a name:value line for each of
+// SignedHeaders and the hex SHA-256 of the body, joined with newlines. The
+// canonical query string is the query parameters sorted by name as
+// name=value, both query escaped, joined with &. Header names are lower case
+// and an absent header is signed with an empty value.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+// Header names of a signed request.
+const (
+	HeaderKey       = "X-Ring-Bridge-Key"
+	HeaderTimestamp = "X-Ring-Bridge-Timestamp"
+	HeaderNonce     = "X-Ring-Bridge-Nonce"
+	HeaderSignature = "X-Ring-Bridge-Signature"
+)
+
+// SignedHeaders are the request headers the signature covers besides its own,
+// they change what the bridge answers.
+var SignedHeaders = []string{"Idempotency-Key", "If-None-Match"}
+
+// Request is what the signature of a bridge request covers.
+type Request struct {
+	Method string
+	// Path is /<action>.
+	Path  string
+	Query map[string]string
+	// Headers are matched case-insensitively, only SignedHeaders are signed.
+	Headers map[string]string
+	Body    []byte
+}
+
+// stringToSign joins the parts of the request the signature covers.
+func (r Request) stringToSign(timestamp, nonce string) string {
+	bodyHash := sha256.Sum256(r.Body)
+	lines := []string{strings.ToUpper(r.Method), r.Path, CanonicalQuery(r.Query), timestamp, nonce}
+	for _, name := range SignedHeaders {
+		lines = append(lines, strings.ToLower(name)+":"+strings.TrimSpace(header(r.Headers, name)))
+	}
+	return strings.Join(append(lines, hex.EncodeToString(bodyHash[:])), "\n")
+}
+
+// CanonicalQuery returns the query parameters sorted by name as name=value,
+// both query escaped, joined with &.
+func CanonicalQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = url.QueryEscape(name) + "=" + url.QueryEscape(query[name])
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Key is a named signing secret.
+type Key struct {
+	Name    string     `json:"name"`
+	Secret  string     `json:"secret"`
+	Created time.Time  `json:"created"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// KeySet is the layout of the signing keys secret.
+type KeySet struct {
+	Keys []Key `json:"keys"`
+}
+
+// Find returns the key with the name.
+func (s KeySet) Find(name string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.Name == name {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// NewKey creates a key with a random 256 bit secret.
+func NewKey(name string) (Key, error) {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return Key{}, fmt.Errorf("invalid key name %q", name)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return Key{Name: name, Secret: base64.RawURLEncoding.EncodeToString(secret), Created: time.Now().UTC()}, nil
+}
+
+// LoadKeys reads the key set from the backend. An empty secret holds no keys.
+func LoadKeys(backend secrets.Backend) (KeySet, error) {
+	var set KeySet
+	value, err := backend.Get()
+	if err != nil {
+		return set, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return set, nil
+	}
+	if err := json.Unmarshal([]byte(value), &set); err != nil {
+		return set, fmt.Errorf("invalid signing keys in %v: %v", backend, err)
+	}
+	return set, nil
+}
+
+// SaveKeys writes the key set to the backend.
+func SaveKeys(backend secrets.Backend, set KeySet) error {
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.Put(string(data))
+}
+
+// Sign returns the hex signature of the request.
+func Sign(secret, timestamp, nonce string, request Request) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(request.stringToSign(timestamp, nonce)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Headers returns the headers of a request signed with the key now. The
+// request must carry the query and the SignedHeaders it is sent with, the
+// signature covers them.
+func Headers(key Key, request Request) (map[string]string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceValue := hex.EncodeToString(nonce)
+	return map[string]string{
+		HeaderKey:       key.Name,
+		HeaderTimestamp: timestamp,
+		HeaderNonce:     nonceValue,
+		HeaderSignature: Sign(key.Secret, timestamp, nonceValue, request),
+	}, nil
+}
+
+// ParseKey reads a key given as <name>:<secret>, the way the clients configure it.
+func ParseKey(value string) (Key, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Key{}, errors.New("signing key must be <name>:<secret>")
+	}
+	return Key{Name: parts[0], Secret: parts[1]}, nil
+}
+
+// Errors of a request failing verification.
+var (
+	ErrUnsigned     = errors.New("request is not signed")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrRevoked      = errors.New("signing key is revoked")
+	ErrExpired      = errors.New("request timestamp is outside the replay window")
+	ErrReplayed     = errors.New("request nonce was already used")
+	ErrBadSignature = errors.New("request signature does not match")
+)
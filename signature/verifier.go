@@ -0,0 +1,98 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+// Verifier checks signed requests against the keys of a backend.
+type Verifier struct {
+	// Backend holds the KeySet.
+	Backend secrets.Backend
+	// Window is how far the request timestamp may be from now.
+	Window time.Duration
+	// KeysTTL is how long the keys are used before they are read again, so a
+	// revoked key stops working within KeysTTL.
+	KeysTTL time.Duration
+	// Nonces remembers the nonces seen within the window. With more than one
+	// Lambda instance it must be a cache.Shared store.
+	Nonces cache.Store
+
+	keys secrets.Reloader
+}
+
+// Verify checks the signature headers of the request and returns the name of
+// the key it was signed with. Header names are matched case-insensitively.
+func (v *Verifier) Verify(request Request) (string, error) {
+	name := header(request.Headers, HeaderKey)
+	timestamp := header(request.Headers, HeaderTimestamp)
+	nonce := header(request.Headers, HeaderNonce)
+	signature := header(request.Headers, HeaderSignature)
+	if name == "" || timestamp == "" || nonce == "" || signature == "" {
+		return "", ErrUnsigned
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return name, ErrExpired
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > v.Window || age < -v.Window {
+		return name, ErrExpired
+	}
+
+	keys, err := v.load()
+	if err != nil {
+		return name, err
+	}
+	key, ok := keys.Find(name)
+	if !ok {
+		return name, ErrUnknownKey
+	}
+	if key.Revoked != nil {
+		return name, ErrRevoked
+	}
+	expected := Sign(key.Secret, timestamp, nonce, request)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return name, ErrBadSignature
+	}
+
+	// The nonce is only remembered for valid signatures, so nobody can burn
+	// the nonces of a client. It is claimed with Add, so two instances sharing
+	// Nonces can not both accept a replay.
+	claimed, err := cache.Add(v.Nonces, "nonce:"+name+":"+nonce, []byte(timestamp), 2*v.Window)
+	if err != nil {
+		return name, err
+	}
+	if !claimed {
+		return name, ErrReplayed
+	}
+	return name, nil
+}
+
+// load returns the keys, reading them again once KeysTTL passed. The last keys
+// are kept when the backend fails.
+func (v *Verifier) load() (KeySet, error) {
+	keys, err := v.keys.Get(v.KeysTTL, "signing keys", func() (interface{}, error) { return LoadKeys(v.Backend) })
+	if err != nil {
+		return KeySet{}, err
+	}
+	return keys.(KeySet), nil
+}
+
+func header(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,327 @@
+package signature
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/cache"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+func newTestVerifier(t *testing.T, keys ...Key) *Verifier {
+	backend := secrets.NewMemory("")
+	if err := SaveKeys(backend, KeySet{Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	return &Verifier{Backend: backend, Window: 5 * time.Minute, KeysTTL: time.Minute, Nonces: cache.NewMemoryStore()}
+}
+
+// signedHeaders signs the request at the time with the nonce.
+func signedHeaders(key Key, method, path string, at time.Time, nonce string, body []byte) map[string]string {
+	return signRequest(key, Request{Method: method, Path: path, Body: body}, at, nonce)
+}
+
+// signRequest signs the request at the time with the nonce and returns its
+// headers with the signature headers added.
+func signRequest(key Key, request Request, at time.Time, nonce string) map[string]string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	headers := map[string]string{}
+	for name, value := range request.Headers {
+		headers[name] = value
+	}
+	headers[HeaderKey] = key.Name
+	headers[HeaderTimestamp] = timestamp
+	headers[HeaderNonce] = nonce
+	headers[HeaderSignature] = Sign(key.Secret, timestamp, nonce, request)
+	return headers
+}
+
+// offRequest is a POST /off with the headers and body.
+func offRequest(headers map[string]string, body []byte) Request {
+	return Request{Method: "POST", Path: "/off", Headers: headers, Body: body}
+}
+
+func TestVerify(t *testing.T) {
+	active := Key{Name: "smartthings", Secret: "secret"}
+	revokedAt := time.Now()
+	revoked := Key{Name: "old", Secret: "old-secret", Revoked: &revokedAt}
+	unknown := Key{Name: "stranger", Secret: "secret"}
+	body := []byte(`{"zid":"1"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			headers: signedHeaders(active, "POST", "/off", now, "n1", body),
+		},
+		{
+			name:    "lower case header names",
+			headers: lowerCase(signedHeaders(active, "POST", "/off", now, "n2", body)),
+		},
+		{
+			name:    "inside the window in the past",
+			headers: signedHeaders(active, "POST", "/off", now.Add(-4*time.Minute), "n3", body),
+		},
+		{
+			name:    "inside the window in the future",
+			headers: signedHeaders(active, "POST", "/off", now.Add(4*time.Minute), "n4", body),
+		},
+		{
+			name:    "older than the window",
+			headers: signedHeaders(active, "POST", "/off", now.Add(-6*time.Minute), "n5", body),
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "newer than the window",
+			headers: signedHeaders(active, "POST", "/off", now.Add(6*time.Minute), "n6", body),
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "timestamp not a number",
+			headers: withHeader(signedHeaders(active, "POST", "/off", now, "n7", body), HeaderTimestamp, "yesterday"),
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "unsigned",
+			headers: map[string]string{},
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "missing nonce",
+			headers: withHeader(signedHeaders(active, "POST", "/off", now, "n8", body), HeaderNonce, ""),
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "unknown key",
+			headers: signedHeaders(unknown, "POST", "/off", now, "n9", body),
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "revoked key",
+			headers: signedHeaders(revoked, "POST", "/off", now, "n10", body),
+			wantErr: ErrRevoked,
+		},
+		{
+			name:    "signed for another action",
+			headers: signedHeaders(active, "POST", "/status", now, "n11", body),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "signed for another method",
+			headers: signedHeaders(active, "GET", "/off", now, "n12", body),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "signed for another body",
+			headers: signedHeaders(active, "POST", "/off", now, "n13", []byte(`{}`)),
+			wantErr: ErrBadSignature,
+		},
+	}
+	verifier := newTestVerifier(t, active, revoked)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := verifier.Verify(offRequest(test.headers, body)); err != test.wantErr {
+				t.Errorf("Verify() = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySignedParts(t *testing.T) {
+	key := Key{Name: "smartthings", Secret: "secret"}
+	signed := Request{
+		Method:  "POST",
+		Path:    "/status",
+		Query:   map[string]string{"since": "1588888888000", "limit": "5"},
+		Headers: map[string]string{"Idempotency-Key": "retry-1", "If-None-Match": `"v1"`},
+		Body:    []byte(`{}`),
+	}
+
+	tests := []struct {
+		name string
+		// change alters the request after it was signed.
+		change  func(request *Request)
+		wantErr error
+	}{
+		{name: "unchanged", change: func(request *Request) {}},
+		{
+			name:   "query in another order",
+			change: func(request *Request) { request.Query = map[string]string{"limit": "5", "since": "1588888888000"} },
+		},
+		{
+			name:   "header names in another case",
+			change: func(request *Request) { request.Headers = lowerCase(request.Headers) },
+		},
+		{
+			name:    "changed query value",
+			change:  func(request *Request) { request.Query = map[string]string{"since": "0", "limit": "5"} },
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "removed query parameter",
+			change:  func(request *Request) { request.Query = map[string]string{"limit": "5"} },
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "added query parameter",
+			change: func(request *Request) {
+				request.Query = map[string]string{"since": "1588888888000", "limit": "5", "x": ""}
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "changed idempotency key",
+			change:  func(request *Request) { request.Headers = withHeader(request.Headers, "Idempotency-Key", "retry-2") },
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "removed If-None-Match",
+			change:  func(request *Request) { request.Headers = withHeader(request.Headers, "If-None-Match", "") },
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:   "unsigned header added",
+			change: func(request *Request) { request.Headers = withHeader(request.Headers, "Accept", "application/json") },
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nonce := strconv.Itoa(i)
+			request := signed
+			request.Headers = signRequest(key, signed, time.Now(), nonce)
+			test.change(&request)
+			if _, err := newTestVerifier(t, key).Verify(request); err != test.wantErr {
+				t.Errorf("Verify() = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+
+	if got, want := CanonicalQuery(map[string]string{"since": "1", "a b": "c&d"}), "a+b=c%26d&since=1"; got != want {
+		t.Errorf("CanonicalQuery() = %q, want %q", got, want)
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	key := Key{Name: "smartthings", Secret: "secret"}
+	body := []byte(`{}`)
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		// first is sent before second, with the same nonce.
+		first   map[string]string
+		second  map[string]string
+		wantErr error
+	}{
+		{
+			name:    "same request again",
+			first:   signedHeaders(key, "POST", "/off", now, "nonce", body),
+			second:  signedHeaders(key, "POST", "/off", now, "nonce", body),
+			wantErr: ErrReplayed,
+		},
+		{
+			name:    "same nonce with a new timestamp",
+			first:   signedHeaders(key, "POST", "/off", now.Add(-time.Minute), "nonce", body),
+			second:  signedHeaders(key, "POST", "/off", now, "nonce", body),
+			wantErr: ErrReplayed,
+		},
+		{
+			name:   "new nonce",
+			first:  signedHeaders(key, "POST", "/off", now, "nonce", body),
+			second: signedHeaders(key, "POST", "/off", now, "other", body),
+		},
+		{
+			name:   "nonce of a forged request is not remembered",
+			first:  withHeader(signedHeaders(key, "POST", "/off", now, "nonce", body), HeaderSignature, "00"),
+			second: signedHeaders(key, "POST", "/off", now, "nonce", body),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := newTestVerifier(t, key)
+			verifier.Verify(offRequest(test.first, body))
+			if _, err := verifier.Verify(offRequest(test.second, body)); err != test.wantErr {
+				t.Errorf("second Verify() = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyConcurrentReplay(t *testing.T) {
+	key := Key{Name: "smartthings", Secret: "secret"}
+	body := []byte(`{}`)
+	headers := signedHeaders(key, "POST", "/off", time.Now(), "nonce", body)
+	// Two instances share the nonce store but not the verifier.
+	first := newTestVerifier(t, key)
+	second := newTestVerifier(t, key)
+	second.Nonces = first.Nonces
+
+	var wg sync.WaitGroup
+	var accepted int32
+	for i := 0; i < 20; i++ {
+		verifier := first
+		if i%2 == 1 {
+			verifier = second
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := verifier.Verify(offRequest(headers, body)); err == nil {
+				atomic.AddInt32(&accepted, 1)
+			} else if err != ErrReplayed {
+				t.Errorf("Verify() = %v, want nil or ErrReplayed", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("%d copies of the request were accepted, want 1", accepted)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	key, err := NewKey("doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseKey(key.Name + ":" + key.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestVerifier(t, key)
+	body := []byte(`{"accessToken":"token"}`)
+	headers, err := Headers(parsed, Request{Method: "POST", Path: "/meta", Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := verifier.Verify(Request{Method: "POST", Path: "/meta", Headers: headers, Body: body}); err != nil || name != key.Name {
+		t.Errorf("Verify() = %q, %v, want %q", name, err, key.Name)
+	}
+
+	for _, value := range []string{"", "doctor", "doctor:", ":secret"} {
+		if _, err := ParseKey(value); err == nil {
+			t.Errorf("ParseKey(%q) succeeded", value)
+		}
+	}
+}
+
+func lowerCase(headers map[string]string) map[string]string {
+	lower := map[string]string{}
+	for name, value := range headers {
+		lower[strings.ToLower(name)] = value
+	}
+	return lower
+}
+
+func withHeader(headers map[string]string, name, value string) map[string]string {
+	headers[name] = value
+	return headers
+}
@@ -0,0 +1,137 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepAlive is how often an idle connection gets a comment or ping, so proxies do not close it.
+const keepAlive = 30 * time.Second
+
+// lastEventID reads where the client resumes, from the Last-Event-ID header
+// EventSource sends on reconnect or the lastEventId query parameter.
+func lastEventID(r *http.Request) uint64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return id
+}
+
+// ServeSSE streams the events as Server-Sent Events until the client goes away.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	backlog, messages, cancel := h.Subscribe(ParseFilter(r.URL.Query()), lastEventID(r))
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	write := func(message Message) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte("id: " + strconv.FormatUint(message.ID, 10) + "\nevent: device\ndata: " + string(data) + "\n\n"))
+		return err
+	}
+	// Ask EventSource to reconnect quickly, it sends Last-Event-ID then.
+	w.Write([]byte("retry: 2000\n\n"))
+	for _, message := range backlog {
+		if err := write(message); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		case message, ok := <-messages:
+			if !ok {
+				log.Printf("Dropping events client %v, it fell behind", r.RemoteAddr)
+				return
+			}
+			if err := write(message); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// upgrader only accepts websocket connections from pages of the bridge
+// origin, so another web page can not read the events through the browser.
+var upgrader = websocket.Upgrader{}
+
+// ServeWS streams the events as JSON websocket messages until the client goes
+// away. Messages from the client are ignored.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already answered the client.
+		return
+	}
+	defer conn.Close()
+	backlog, messages, cancel := h.Subscribe(ParseFilter(r.URL.Query()), lastEventID(r))
+	defer cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(message Message) error {
+		conn.SetWriteDeadline(time.Now().Add(keepAlive))
+		return conn.WriteJSON(message)
+	}
+	for _, message := range backlog {
+		if err := write(message); err != nil {
+			return
+		}
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAlive)); err != nil {
+				return
+			}
+		case message, ok := <-messages:
+			if !ok {
+				log.Printf("Dropping events client %v, it fell behind", r.RemoteAddr)
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind"), time.Now().Add(time.Second))
+				return
+			}
+			if err := write(message); err != nil {
+				return
+			}
+		}
+	}
+}
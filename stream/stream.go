@@ -0,0 +1,171 @@
+// Package stream relays the alarm events of one Ring websocket connection to
+// any number of local clients, over Server-Sent Events or a websocket. Recent
+// events are kept, so a client that reconnects resumes from its last event.
+package stream
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+)
+
+// DefaultSize is how many recent events a Hub keeps for clients that resume.
+const DefaultSize = 500
+
+// clientBuffer is how many events a slow client may fall behind before it is dropped.
+const clientBuffer = 64
+
+// Message is an event as the clients receive it.
+type Message struct {
+	// ID increases with every event, also across restarts of the bridge.
+	ID         uint64 `json:"id"`
+	LocationID string `json:"locationId"`
+	alarmstate.Event
+}
+
+// Filter picks the events a client receives. An empty list allows everything.
+type Filter struct {
+	ZIDs []string
+	// Types are device types, a type ending in . matches every type it starts, e.g. sensor.
+	Types []string
+	// Fields are the changed fields, e.g. faulted or mode.
+	Fields []string
+}
+
+// ParseFilter reads the zid, type and field query parameters, each repeated or comma separated.
+func ParseFilter(query url.Values) Filter {
+	list := func(name string) []string {
+		var values []string
+		for _, value := range query[name] {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					values = append(values, part)
+				}
+			}
+		}
+		return values
+	}
+	return Filter{ZIDs: list("zid"), Types: list("type"), Fields: list("field")}
+}
+
+// Matches reports whether the client asked for the message.
+func (f Filter) Matches(message Message) bool {
+	if len(f.ZIDs) > 0 && !contains(f.ZIDs, message.ZID) {
+		return false
+	}
+	if len(f.Types) > 0 {
+		matched := false
+		for _, t := range f.Types {
+			if t == message.DeviceType || strings.HasSuffix(t, ".") && strings.HasPrefix(message.DeviceType, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Fields) > 0 {
+		for _, change := range message.Changes {
+			if contains(f.Fields, change.Field) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriber struct {
+	filter   Filter
+	messages chan Message
+}
+
+// Hub passes every published event to the subscribed clients.
+type Hub struct {
+	mu          sync.Mutex
+	size        int
+	lastID      uint64
+	recent      []Message
+	subscribers map[*subscriber]bool
+}
+
+// NewHub creates a Hub keeping the last size events.
+func NewHub(size int) *Hub {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	// Starting at the time in milliseconds keeps the IDs increasing when the
+	// bridge restarts, so a resuming client does not skip new events.
+	return &Hub{size: size, lastID: uint64(time.Now().UnixNano() / int64(time.Millisecond)), subscribers: map[*subscriber]bool{}}
+}
+
+// Publish sends the event to every client whose filter matches it. A client
+// that fell too far behind is dropped, it can resume from its last event.
+func (h *Hub) Publish(locationID string, event alarmstate.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	message := Message{ID: h.lastID, LocationID: locationID, Event: event}
+	h.recent = append(h.recent, message)
+	if len(h.recent) > h.size {
+		h.recent = h.recent[len(h.recent)-h.size:]
+	}
+	for s := range h.subscribers {
+		if !s.filter.Matches(message) {
+			continue
+		}
+		select {
+		case s.messages <- message:
+		default:
+			delete(h.subscribers, s)
+			close(s.messages)
+		}
+	}
+}
+
+// Subscribe returns the kept events after lastID that match the filter, and
+// a channel of the events to come. The channel is closed when the client
+// falls behind. cancel ends the subscription.
+func (h *Hub) Subscribe(filter Filter, lastID uint64) ([]Message, <-chan Message, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var backlog []Message
+	if lastID > 0 {
+		for _, message := range h.recent {
+			if message.ID > lastID && filter.Matches(message) {
+				backlog = append(backlog, message)
+			}
+		}
+	}
+	s := &subscriber{filter: filter, messages: make(chan Message, clientBuffer)}
+	h.subscribers[s] = true
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.subscribers[s] {
+			delete(h.subscribers, s)
+			close(s.messages)
+		}
+	}
+	return backlog, s.messages, cancel
+}
+
+// Clients returns how many clients are subscribed.
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a notification that could not be delivered.
+type DeadLetter struct {
+	Time         time.Time    `json:"time"`
+	Hook         string       `json:"hook"`
+	URL          string       `json:"url"`
+	Attempts     int          `json:"attempts"`
+	Error        string       `json:"error"`
+	Notification Notification `json:"notification"`
+}
+
+// DeadLetterSink keeps the failed deliveries. Implementations must be safe for concurrent use.
+type DeadLetterSink interface {
+	Write(letter DeadLetter) error
+}
+
+// NewDeadLetterSink creates a sink from a spec:
+//
+//	log          - one DEADLETTER JSON line per delivery in the log (default)
+//	file:<path>  - one JSON line per delivery appended to the file
+func NewDeadLetterSink(spec string) (DeadLetterSink, error) {
+	switch {
+	case spec == "" || spec == "log":
+		return LogDeadLetters{}, nil
+	case strings.HasPrefix(spec, "file:") && len(spec) > len("file:"):
+		return &FileDeadLetters{path: strings.TrimPrefix(spec, "file:")}, nil
+	default:
+		return nil, fmt.Errorf("webhook: unknown dead letter sink %q, use log or file:<path>", spec)
+	}
+}
+
+// LogDeadLetters writes the failed deliveries to the log, CloudWatch for the Lambda.
+type LogDeadLetters struct{}
+
+// Write logs the letter as one line.
+func (LogDeadLetters) Write(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	log.Printf("DEADLETTER %s", data)
+	return nil
+}
+
+// FileDeadLetters appends the failed deliveries to a JSON lines file.
+type FileDeadLetters struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Write appends the letter as one line.
+func (s *FileDeadLetters) Write(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
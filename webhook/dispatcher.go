@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/retry"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+// Header names of a delivery.
+const (
+	HeaderEvent     = "X-Ring-Bridge-Event"
+	HeaderDelivery  = "X-Ring-Bridge-Delivery"
+	HeaderTimestamp = "X-Ring-Bridge-Timestamp"
+	HeaderSignature = "X-Ring-Bridge-Signature"
+)
+
+// DefaultRetry is used by a Dispatcher without a Retry policy.
+var DefaultRetry = retry.Policy{Attempts: 4, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+// Dispatcher delivers notifications to the hooks of a backend.
+type Dispatcher struct {
+	Backend secrets.Backend
+	// HooksTTL is how long the hooks are used before they are read again.
+	HooksTTL time.Duration
+	// Retry is the policy of a single delivery, DefaultRetry when zero.
+	Retry retry.Policy
+	// DeadLetters receives the deliveries that failed every attempt.
+	DeadLetters DeadLetterSink
+	// Client posts the deliveries, http.DefaultClient when nil.
+	Client *http.Client
+
+	hooks secrets.Reloader
+}
+
+// Notify delivers every notification to the hooks subscribed to its event and
+// returns once all deliveries are done. Deliveries to different hooks run at
+// the same time.
+func (d *Dispatcher) Notify(notifications []Notification) {
+	if len(notifications) == 0 {
+		return
+	}
+	hooks, err := d.load()
+	if err != nil {
+		log.Printf("Unable to read the webhooks, dropping %d notifications - %v", len(notifications), err)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, hook := range hooks.Hooks {
+		var wanted []Notification
+		for _, notification := range notifications {
+			if hook.Wants(notification.Kind) {
+				wanted = append(wanted, notification)
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(hook Hook) {
+			defer wg.Done()
+			// One hook gets its notifications in order.
+			for _, notification := range wanted {
+				d.Deliver(hook, notification)
+			}
+		}(hook)
+	}
+	wg.Wait()
+}
+
+// Deliver posts the notification to the hook, retrying failed attempts. A
+// delivery that fails every attempt is written to DeadLetters.
+func (d *Dispatcher) Deliver(hook Hook, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	policy := d.Retry
+	if policy.Attempts == 0 {
+		policy = DefaultRetry
+	}
+	attempts := 0
+	err = policy.Do("Webhook "+hook.Name, func() error {
+		attempts++
+		return d.post(hook, notification, body)
+	})
+	if err == nil {
+		return nil
+	}
+	log.Printf("Webhook %v failed for %v %v - %v", hook.Name, notification.Kind, notification.ID, err)
+	if d.DeadLetters != nil {
+		letter := DeadLetter{Time: time.Now().UTC(), Hook: hook.Name, URL: hook.URL, Attempts: attempts, Error: err.Error(), Notification: notification}
+		if writeErr := d.DeadLetters.Write(letter); writeErr != nil {
+			log.Printf("Unable to write the dead letter of webhook %v - %v", hook.Name, writeErr)
+		}
+	}
+	return err
+}
+
+// post sends one signed attempt. Client errors other than 408 and 429 are not retried.
+func (d *Dispatcher) post(hook Hook, notification Notification, body []byte) error {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, notification.Kind)
+	req.Header.Set(HeaderDelivery, notification.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		return retry.Permanent(fmt.Errorf("%v answered %v", hook.URL, res.Status))
+	default:
+		return fmt.Errorf("%v answered %v", hook.URL, res.Status)
+	}
+}
+
+// Sign returns the X-Ring-Bridge-Signature value of a delivery.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// load returns the hooks, reading them again once HooksTTL passed. The last
+// hooks are kept when the backend fails.
+func (d *Dispatcher) load() (HookSet, error) {
+	hooks, err := d.hooks.Get(d.HooksTTL, "webhooks", func() (interface{}, error) { return LoadHooks(d.Backend) })
+	if err != nil {
+		return HookSet{}, err
+	}
+	return hooks.(HookSet), nil
+}
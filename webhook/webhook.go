@@ -0,0 +1,201 @@
+// Package webhook posts alarm events to the URLs registered by the user.
+//
+// Every delivery is a POST of a Notification as JSON with the headers
+//
+//	X-Ring-Bridge-Event      event of the notification, e.g. sensor-faulted
+//	X-Ring-Bridge-Delivery   ID of the notification, the same for every retry
+//	X-Ring-Bridge-Timestamp  unix time in seconds
+//	X-Ring-Bridge-Signature  sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// The HMAC key is the secret of the webhook.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/alarmstate"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+)
+
+// Events a webhook can subscribe to.
+const (
+	EventModeChange     = "mode-change"
+	EventSensorFaulted  = "sensor-faulted"
+	EventAlarmTriggered = "alarm-triggered"
+	EventBatteryLow     = "battery-low"
+)
+
+// AllEvents are the valid events.
+var AllEvents = []string{EventModeChange, EventSensorFaulted, EventAlarmTriggered, EventBatteryLow}
+
+// LowBatteryLevel is the battery level in percent below which a device reports battery-low.
+const LowBatteryLevel = 20
+
+// Hook is a registered URL.
+type Hook struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	Events  []string  `json:"events"`
+	Secret  string    `json:"secret"`
+	Created time.Time `json:"created"`
+}
+
+// Wants reports whether the hook subscribed to the event.
+func (h Hook) Wants(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// HookSet is the layout of the webhooks secret.
+type HookSet struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// Find returns the hook with the name.
+func (s HookSet) Find(name string) (Hook, bool) {
+	for _, hook := range s.Hooks {
+		if hook.Name == name {
+			return hook, true
+		}
+	}
+	return Hook{}, false
+}
+
+// ValidateEvents reports the first unknown event.
+func ValidateEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("a webhook needs at least one event")
+	}
+	for _, event := range events {
+		valid := false
+		for _, known := range AllEvents {
+			valid = valid || event == known
+		}
+		if !valid {
+			return fmt.Errorf("unknown event %q, use %v", event, strings.Join(AllEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// NewHook creates a hook with a random 256 bit secret.
+func NewHook(name, rawURL string, events []string) (Hook, error) {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return Hook{}, fmt.Errorf("invalid webhook name %q", name)
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return Hook{}, fmt.Errorf("invalid webhook URL %q, use http(s)://host/path", rawURL)
+	}
+	if err := ValidateEvents(events); err != nil {
+		return Hook{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Hook{}, err
+	}
+	return Hook{Name: name, URL: rawURL, Events: events, Secret: base64.RawURLEncoding.EncodeToString(secret), Created: time.Now().UTC()}, nil
+}
+
+// LoadHooks reads the hooks from the backend. An empty secret holds no hooks.
+func LoadHooks(backend secrets.Backend) (HookSet, error) {
+	var set HookSet
+	value, err := backend.Get()
+	if err != nil {
+		return set, err
+	}
+	if strings.TrimSpace(value) == "" {
+		return set, nil
+	}
+	if err := json.Unmarshal([]byte(value), &set); err != nil {
+		return set, fmt.Errorf("invalid webhooks in %v: %v", backend, err)
+	}
+	return set, nil
+}
+
+// SaveHooks writes the hooks to the backend.
+func SaveHooks(backend secrets.Backend, set HookSet) error {
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.Put(string(data))
+}
+
+// Notification is the body of a delivery.
+type Notification struct {
+	// ID identifies the notification, receivers can use it to drop duplicates.
+	ID string `json:"id"`
+	// Kind is the webhook event, e.g. sensor-faulted.
+	Kind       string `json:"event"`
+	LocationID string `json:"locationId"`
+	alarmstate.Event
+}
+
+// Notifications returns a notification for every webhook event in the device changes.
+func Notifications(locationID string, changes []alarmstate.Event) []Notification {
+	var notifications []Notification
+	for _, change := range changes {
+		for _, event := range classify(change) {
+			notifications = append(notifications, Notification{ID: newID(), Kind: event, LocationID: locationID, Event: change})
+		}
+	}
+	return notifications
+}
+
+// classify returns the webhook events of the changes of one device.
+func classify(change alarmstate.Event) []string {
+	var events []string
+	add := func(event string) {
+		for _, e := range events {
+			if e == event {
+				return
+			}
+		}
+		events = append(events, event)
+	}
+	for _, c := range change.Changes {
+		switch c.Field {
+		case "mode":
+			add(EventModeChange)
+		case "faulted":
+			if c.To == "true" {
+				add(EventSensorFaulted)
+			}
+		case "alarmState":
+			if c.To != "" {
+				add(EventAlarmTriggered)
+			}
+		case "batteryStatus":
+			if c.To == "low" || c.To == "critical" {
+				add(EventBatteryLow)
+			}
+		case "batteryLevel":
+			from, _ := strconv.Atoi(c.From)
+			to, _ := strconv.Atoi(c.To)
+			if from >= LowBatteryLevel && to > 0 && to < LowBatteryLevel {
+				add(EventBatteryLow)
+			}
+		}
+	}
+	return events
+}
+
+func newID() string {
+	random := make([]byte, 12)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/asishrs/smartthings-ringalarmv2/secrets"
+	"github.com/asishrs/smartthings-ringalarmv2/webhook"
+)
+
+// dispatcher posts the device changes to the webhooks of RING_WEBHOOKS, nil without webhooks.
+var dispatcher *webhook.Dispatcher
+
+// configureWebhooks reads the webhooks from the spec when it is set.
+func configureWebhooks(spec, deadLetterSpec string, hooksTTL time.Duration) error {
+	if spec == "" {
+		return nil
+	}
+	backend, err := secrets.New(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := webhook.LoadHooks(backend); err != nil {
+		return err
+	}
+	deadLetters, err := webhook.NewDeadLetterSink(deadLetterSpec)
+	if err != nil {
+		return err
+	}
+	log.Printf("Sending alarm events to the webhooks of %v", backend)
+	dispatcher = &webhook.Dispatcher{Backend: backend, HooksTTL: hooksTTL, DeadLetters: deadLetters, Client: httputil.Client}
+	return nil
+}
@@ -0,0 +1,351 @@
+package wsutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asishrs/smartthings-ringalarmv2/httputil"
+	"github.com/gorilla/websocket"
+)
+
+// RequestTimeout is how long a Session waits for Ring to answer a request.
+var RequestTimeout = 10 * time.Second
+
+// ErrSessionClosed is returned for requests on a closed Session.
+var ErrSessionClosed = errors.New("wsutil: session closed")
+
+// Message is a request sent to Ring over the websocket.
+type Message struct {
+	Msg      string      `json:"msg"`
+	DataType string      `json:"datatype,omitempty"`
+	Body     interface{} `json:"body,omitempty"`
+	Seq      int         `json:"seq"`
+}
+
+// Session is one websocket connection to Ring that carries any number of
+// requests. Replies are matched to requests on their sequence number and
+// every other message, like DataUpdate, is handed to the subscribers.
+type Session struct {
+	conn    Conn
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	seq         int
+	pending     map[int]chan *httputil.RingDeviceInfo
+	subscribers map[chan *httputil.RingDeviceInfo]bool
+	err         error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Open dials the Ring websocket server for the connection and starts reading from it.
+func Open(connection httputil.RingWSConnection) (*Session, error) {
+	wssURL, err := wsConnection(connection)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := Dial(wssURL)
+	if err != nil {
+		httputil.Trace.Println("dial:", err)
+		return nil, err
+	}
+	s := &Session{
+		conn:        conn,
+		pending:     make(map[int]chan *httputil.RingDeviceInfo),
+		subscribers: make(map[chan *httputil.RingDeviceInfo]bool),
+		done:        make(chan struct{}),
+	}
+	go s.readLoop()
+	return s, nil
+}
+
+// Done is closed when the session ends, either by Close or a read error.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that ended the session, if any.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close cleanly closes the websocket connection.
+func (s *Session) Close() error {
+	s.writeMu.Lock()
+	err := s.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	s.writeMu.Unlock()
+	if err != nil {
+		httputil.Trace.Println("write close:", err)
+	}
+	s.finish(nil)
+	return s.conn.Close()
+}
+
+// Subscribe returns a channel receiving every message that is not a reply to
+// a request. The channel is closed when the session ends or cancel is called.
+func (s *Session) Subscribe() (<-chan *httputil.RingDeviceInfo, func()) {
+	ch := make(chan *httputil.RingDeviceInfo, 32)
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	default:
+	}
+	s.subscribers[ch] = true
+	s.mu.Unlock()
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.subscribers[ch] {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, cancel
+}
+
+// Request sends the message and waits for the reply with the same sequence number.
+func (s *Session) Request(message Message) (*httputil.RingDeviceInfo, error) {
+	reply, err := s.send(message)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(RequestTimeout)
+	defer timer.Stop()
+	select {
+	case response := <-reply:
+		return response, nil
+	case <-s.done:
+		return nil, s.closedErr()
+	case <-timer.C:
+		return nil, fmt.Errorf("wsutil: no reply to %v after %v", message.Msg, RequestTimeout)
+	}
+}
+
+// DeviceList returns all the devices in the location.
+func (s *Session) DeviceList() (*httputil.RingDeviceInfo, error) {
+	return s.Request(Message{Msg: "DeviceInfoDocGetList"})
+}
+
+// SetMode switches the security panel with the zid to the mode (none, some or all).
+// It returns once Ring acknowledges the command or reports a change of the panel.
+func (s *Session) SetMode(zid string, mode string) error {
+	return s.Command(zid, "security-panel.switch-mode", map[string]string{"mode": mode})
+}
+
+// Command sends a device command and returns once Ring acknowledges it or
+// reports a change of the device. Ring does not always answer a command, so
+// running out of time is logged but not treated as a failure.
+func (s *Session) Command(zid string, commandType string, data interface{}) error {
+	body := []map[string]interface{}{{
+		"zid": zid,
+		"command": map[string]interface{}{
+			"v1": []map[string]interface{}{{
+				"commandType": commandType,
+				"data":        data,
+			}},
+		},
+	}}
+	return s.Set(zid, body)
+}
+
+// Set sends a DeviceInfoSet message with the body and waits like Command.
+func (s *Session) Set(zid string, body interface{}) error {
+	updates, cancel := s.Subscribe()
+	defer cancel()
+
+	reply, err := s.send(Message{Msg: "DeviceInfoSet", DataType: "DeviceInfoSetType", Body: body})
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(RequestTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-reply:
+			return nil
+		case update, ok := <-updates:
+			if !ok {
+				return s.closedErr()
+			}
+			if update.Message == "DataUpdate" && containsZID(update, zid) {
+				return nil
+			}
+		case <-s.done:
+			return s.closedErr()
+		case <-timer.C:
+			httputil.Trace.Printf("No confirmation from Ring for %v after %v", zid, RequestTimeout)
+			return nil
+		}
+	}
+}
+
+func containsZID(info *httputil.RingDeviceInfo, zid string) bool {
+	for i := range info.Body {
+		if info.Body[i].General.V2.ZID == zid {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) send(message Message) (chan *httputil.RingDeviceInfo, error) {
+	reply := make(chan *httputil.RingDeviceInfo, 1)
+	s.mu.Lock()
+	if s.isDone() {
+		s.mu.Unlock()
+		return nil, s.closedErr()
+	}
+	s.seq++
+	message.Seq = s.seq
+	s.pending[message.Seq] = reply
+	s.mu.Unlock()
+
+	payload, err := json.Marshal([]interface{}{"message", message})
+	if err != nil {
+		s.forget(message.Seq)
+		return nil, err
+	}
+	s.writeMu.Lock()
+	err = s.conn.WriteMessage(websocket.TextMessage, append([]byte("42"), payload...))
+	s.writeMu.Unlock()
+	if err != nil {
+		httputil.Trace.Println("write:", err)
+		s.forget(message.Seq)
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (s *Session) forget(seq int) {
+	s.mu.Lock()
+	delete(s.pending, seq)
+	s.mu.Unlock()
+}
+
+func (s *Session) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Session) closedErr() error {
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return ErrSessionClosed
+}
+
+func (s *Session) finish(err error) {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		close(s.done)
+		for ch := range s.subscribers {
+			close(ch)
+		}
+		s.subscribers = map[chan *httputil.RingDeviceInfo]bool{}
+		s.mu.Unlock()
+	})
+}
+
+func (s *Session) readLoop() {
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if !s.isDone() {
+				httputil.Trace.Println("read:", err)
+			}
+			s.finish(err)
+			return
+		}
+		s.handle(string(data))
+	}
+}
+
+// handle processes one socket.io (EIO=3) packet.
+func (s *Session) handle(packet string) {
+	switch {
+	case strings.HasPrefix(packet, "0"):
+		var open struct {
+			PingInterval int `json:"pingInterval"`
+		}
+		if err := json.Unmarshal([]byte(packet[1:]), &open); err == nil && open.PingInterval > 0 {
+			go s.ping(time.Duration(open.PingInterval) * time.Millisecond)
+		}
+	case strings.HasPrefix(packet, "42"):
+		info, err := parseEvent(packet[2:])
+		if err != nil {
+			httputil.Trace.Println("Unable to Parse Ring Message: ", err)
+			return
+		}
+		s.dispatch(info)
+	}
+}
+
+func parseEvent(event string) (*httputil.RingDeviceInfo, error) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal([]byte(event), &parts); err != nil {
+		return nil, err
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("wsutil: event without data %q", event)
+	}
+	var info httputil.RingDeviceInfo
+	if err := json.Unmarshal(parts[1], &info); err != nil {
+		return nil, err
+	}
+	info.Raw = parts[1]
+	return &info, nil
+}
+
+func (s *Session) dispatch(info *httputil.RingDeviceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reply, ok := s.pending[info.Sequence]; ok && info.Sequence != 0 && info.Message != "DataUpdate" {
+		delete(s.pending, info.Sequence)
+		reply <- info
+		return
+	}
+	for ch := range s.subscribers {
+		select {
+		case ch <- info:
+		default:
+			httputil.Trace.Printf("Dropping %v message for a slow subscriber", info.Message)
+		}
+	}
+}
+
+// ping keeps the socket.io connection alive.
+func (s *Session) ping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.writeMu.Lock()
+			err := s.conn.WriteMessage(websocket.TextMessage, []byte("2"))
+			s.writeMu.Unlock()
+			if err != nil {
+				httputil.Trace.Println("ping:", err)
+				return
+			}
+		}
+	}
+}
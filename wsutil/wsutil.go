@@ -2,12 +2,9 @@ package wsutil
 
 import (
 	"bytes"
-	"encoding/json"
-	"flag"
-	"log"
-	"os"
-	"os/signal"
-	"strings"
+	"crypto/tls"
+	"net/http"
+	"net/url"
 	"text/template"
 	"time"
 
@@ -15,133 +12,95 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-func Status(zid string, mode string, connection httputil.RingWSConnection) (string, error) {
-	wssInput := "42[\n" +
-		"    \"message\",\n" +
-		"    {\n" +
-		"        \"msg\": \"DeviceInfoSet\",\n" +
-		"        \"datatype\": \"DeviceInfoSetType\",\n" +
-		"        \"body\": [\n" +
-		"            {\n" +
-		"                \"zid\": \"" + zid + "\",\n" +
-		"                \"command\": {\n" +
-		"                    \"v1\": [\n" +
-		"                        {\n" +
-		"                            \"commandType\": \"security-panel.switch-mode\",\n" +
-		"                            \"data\": {\n" +
-		"                                \"mode\": \"" + mode + "\"\n" +
-		"                            }\n" +
-		"                        }\n" +
-		"                    ]\n" +
-		"                }\n" +
-		"            }\n" +
-		"        ],\n" +
-		"        \"seq\": 2\n" +
-		"    }\n" +
-		"]"
-
-	// log.Println("WS Connection " + wssInput)
-	wssCall(connection, wssInput, "DataUpdate", 1)
-
-	return "SUCCESS", nil
+// Conn is the part of a websocket connection used to talk to Ring.
+type Conn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(int, []byte) error
+	Close() error
 }
 
-func wsConnection(connection httputil.RingWSConnection) (string, error) {
-	wsConnectionTemplate := template.New("wscon")
-	wsConnectionTemplate, err := wsConnectionTemplate.Parse("wss://{{.Server}}/socket.io/?authcode={{.AuthCode}}&ack=false&EIO=3&transport=websocket")
+var (
+	dialer      = newDialer(http.ProxyFromEnvironment, nil, httputil.DefaultClientConfig().Timeout)
+	dialHeaders = http.Header{"User-Agent": {httputil.DefaultUserAgent}}
+)
+
+// Dial opens the websocket connection to the Ring server. It can be replaced,
+// e.g. to record or replay the websocket frames.
+var Dial = func(url string) (Conn, error) {
+	c, _, err := dialer.Dial(url, dialHeaders)
 	if err != nil {
-		log.Println("Parse: ", err)
-		return "", err
+		return nil, err
 	}
-	var wsConnection bytes.Buffer
-	wsConnectionTemplate.Execute(&wsConnection, connection)
-	return wsConnection.String(), nil
+	return c, nil
 }
 
-func wssCall(connection httputil.RingWSConnection, wssInput string, messageType string, waitTime int) (string, error) {
-	var wssResponse string
-
-	wssUrl, err := wsConnection(connection)
+// Configure applies the proxy, certificate authorities, handshake timeout and
+// User-Agent of the configuration to the websocket dialer.
+func Configure(config httputil.ClientConfig) error {
+	proxy, err := config.Proxy()
 	if err != nil {
-		log.Println("Parse: ", err)
-		return "", err
+		return err
 	}
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return err
+	}
+	dialer = newDialer(proxy, tlsConfig, config.Timeout)
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = httputil.DefaultUserAgent
+	}
+	dialHeaders = http.Header{"User-Agent": {userAgent}}
+	return nil
+}
 
-	flag.Parse()
-	log.SetFlags(0)
-
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
+func newDialer(proxy func(*http.Request) (*url.URL, error), tlsConfig *tls.Config, timeout time.Duration) *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            proxy,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: timeout,
+	}
+}
 
-	c, _, err := websocket.DefaultDialer.Dial(wssUrl, nil)
+// Status switches the security panel with the zid to the mode on its own websocket connection.
+func Status(zid string, mode string, connection httputil.RingWSConnection) (string, error) {
+	session, err := Open(connection)
 	if err != nil {
-		log.Println("dial:", err)
 		return "", err
 	}
-	defer c.Close()
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		for {
-			_, message, err := c.ReadMessage()
-			if err != nil {
-				log.Println("read:", err)
-				return
-			}
+	defer session.Close()
 
-			s := string(message)
-			//log.Printf("recv: %s\n", s)
-			if strings.Contains(s, messageType) {
-				wssResponse = s
-			}
-		}
-	}()
-
-	writeErr := c.WriteMessage(websocket.TextMessage, []byte(wssInput))
-	if writeErr != nil {
-		log.Println("write:", writeErr)
-		return "", writeErr
+	if err := session.SetMode(zid, mode); err != nil {
+		return "", err
 	}
+	return "SUCCESS", nil
+}
 
-	time.Sleep(time.Duration(waitTime) * time.Second)
-	log.Printf("Timeout after %d seconds", waitTime)
-
-	// Cleanly close the connection by sending a close message and then
-	// waiting (with timeout) for the server to close the connection.
-	stopErr := c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-	if stopErr != nil {
-		log.Println("write close:", stopErr)
-		//ignore the error
+func wsConnection(connection httputil.RingWSConnection) (string, error) {
+	wsConnectionTemplate := template.New("wscon")
+	wsConnectionTemplate, err := wsConnectionTemplate.Parse("wss://{{.Server}}/socket.io/?authcode={{.AuthCode}}&ack=false&EIO=3&transport=websocket")
+	if err != nil {
+		httputil.Trace.Println("Parse: ", err)
+		return "", err
 	}
-
-	return wssResponse, nil
+	var wsConnection bytes.Buffer
+	wsConnectionTemplate.Execute(&wsConnection, connection)
+	return wsConnection.String(), nil
 }
 
 // ActiveDevices - Find all active devices in the Ring Alarm account.
 func ActiveDevices(connection httputil.RingWSConnection) (*httputil.RingDeviceInfo, error) {
-	wssInput := "42[\"message\",{\"msg\":\"DeviceInfoDocGetList\",\"seq\":1}]"
-	wssResponse, err := wssCall(connection, wssInput, "DeviceInfoDocGetList", 3)
+	session, err := Open(connection)
 	if err != nil {
-		log.Println("Error: ", err)
+		httputil.Trace.Println("Error: ", err)
 		return nil, err
 	}
+	defer session.Close()
 
-	if len(wssResponse) == 0 {
-		log.Println("No Response: ", err)
-		return nil, err
-	}
-
-	var ringDeviceInfo httputil.RingDeviceInfo
-	runes := []rune(wssResponse)
-	responseBody := string(runes[13 : len(wssResponse)-1])
-	//log.Printf("Response: %s\n\nJSON: %s", wssResponse, responseBody)
-	responseBody = responseBody[:strings.LastIndex(responseBody, "}")+1]
-	// log.Printf("Response: %s", responseBody)
-	err = json.Unmarshal([]byte(responseBody), &ringDeviceInfo)
+	ringDeviceInfo, err := session.DeviceList()
 	if err != nil {
-		log.Println("Unable to Parse Status Response Data: ", err)
+		httputil.Trace.Println("Error: ", err)
 		return nil, err
 	}
-
-	return &ringDeviceInfo, nil
+	return ringDeviceInfo, nil
 }